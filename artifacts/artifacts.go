@@ -0,0 +1,184 @@
+package artifacts
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"github.com/michaelhenkel/cn2kubevirt/inventory"
+	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	"github.com/michaelhenkel/cn2kubevirt/kubespray"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	InventoryKey = "inventory.yaml"
+	DeployerKey  = "deployer.yaml"
+)
+
+var kubeconfigKeys = []string{kubespray.KubeconfigKey, inventory.ExternalKubeconfig}
+
+// InventoryConfigMapName returns the name of the ConfigMap holding the
+// inventory.
+func InventoryConfigMapName(cl *cluster.Cluster) string {
+	return fmt.Sprintf("%s-inventory", cl.Name)
+}
+
+// DeployerConfigMapName returns the name of the ConfigMap holding the
+// deployer manifest.
+func DeployerConfigMapName(cl *cluster.Cluster) string {
+	return fmt.Sprintf("%s-deployer", cl.Name)
+}
+
+// Store copies inventory.yaml, deployer.yaml, admin.conf and
+// admin.external.conf from Kubeconfigdir to the cluster namespace. The
+// kubeconfigs are stored in the Secret written by the kubespray Job.
+// Missing files are skipped.
+func Store(client *k8s.Client, cl *cluster.Cluster) error {
+	for _, cm := range []struct {
+		name string
+		key  string
+	}{
+		{name: InventoryConfigMapName(cl), key: InventoryKey},
+		{name: DeployerConfigMapName(cl), key: DeployerKey},
+	} {
+		content, err := readFile(cl, cm.key)
+		if err != nil {
+			return err
+		}
+		if content == nil {
+			continue
+		}
+		if err := storeConfigMap(client, defineConfigMap(cl, cm.name, cm.key, content)); err != nil {
+			return err
+		}
+		klog.Infof("stored %s in configmap %s/%s", cm.key, cl.Namespace, cm.name)
+	}
+	var kubeconfigs = make(map[string][]byte)
+	for _, key := range kubeconfigKeys {
+		content, err := readFile(cl, key)
+		if err != nil {
+			return err
+		}
+		if content != nil {
+			kubeconfigs[key] = content
+		}
+	}
+	if len(kubeconfigs) == 0 {
+		return nil
+	}
+	if err := storeSecret(client, defineSecret(cl, kubeconfigs)); err != nil {
+		return err
+	}
+	klog.Infof("stored kubeconfig in secret %s/%s", cl.Namespace, kubespray.KubeconfigSecretName(cl))
+	return nil
+}
+
+// Fetch returns the stored files of the cluster by file name. Only Name
+// and Namespace of cl are used.
+func Fetch(client *k8s.Client, cl *cluster.Cluster) (map[string][]byte, error) {
+	var files = make(map[string][]byte)
+	ctx := context.Background()
+	for name, key := range map[string]string{
+		InventoryConfigMapName(cl): InventoryKey,
+		DeployerConfigMapName(cl):  DeployerKey,
+	} {
+		cm, err := client.K8S.CoreV1().ConfigMaps(cl.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if content, ok := cm.Data[key]; ok {
+			files[key] = []byte(content)
+		}
+	}
+	secret, err := client.K8S.CoreV1().Secrets(cl.Namespace).Get(ctx, kubespray.KubeconfigSecretName(cl), metav1.GetOptions{})
+	if err == nil {
+		for _, key := range kubeconfigKeys {
+			if content, ok := secret.Data[key]; ok {
+				files[key] = content
+			}
+		}
+	} else if !errors.IsNotFound(err) {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Delete removes the stored ConfigMaps. The kubeconfig Secret is deleted
+// together with the kubespray resources.
+func Delete(client *k8s.Client, cl *cluster.Cluster) error {
+	for _, name := range []string{InventoryConfigMapName(cl), DeployerConfigMapName(cl)} {
+		err := client.K8S.CoreV1().ConfigMaps(cl.Namespace).Delete(context.Background(), name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFile(cl *cluster.Cluster, name string) ([]byte, error) {
+	content, err := os.ReadFile(filepath.Join(cl.Kubeconfigdir, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return content, err
+}
+
+func objectMeta(cl *cluster.Cluster, name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: cl.Namespace,
+		Labels:    map[string]string{"cluster": cl.Name},
+	}
+}
+
+func defineConfigMap(cl *cluster.Cluster, name, key string, content []byte) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: objectMeta(cl, name),
+		Data: map[string]string{
+			key: string(content),
+		},
+	}
+}
+
+func defineSecret(cl *cluster.Cluster, kubeconfigs map[string][]byte) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: objectMeta(cl, kubespray.KubeconfigSecretName(cl)),
+		Data:       kubeconfigs,
+	}
+}
+
+func storeConfigMap(client *k8s.Client, cm *v1.ConfigMap) error {
+	current, err := client.K8S.CoreV1().ConfigMaps(cm.Namespace).Get(context.Background(), cm.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.K8S.CoreV1().ConfigMaps(cm.Namespace).Create(context.Background(), cm, metav1.CreateOptions{})
+		return err
+	} else if err != nil {
+		return err
+	}
+	current.Labels = cm.Labels
+	current.Data = cm.Data
+	_, err = client.K8S.CoreV1().ConfigMaps(cm.Namespace).Update(context.Background(), current, metav1.UpdateOptions{})
+	return err
+}
+
+func storeSecret(client *k8s.Client, secret *v1.Secret) error {
+	current, err := client.K8S.CoreV1().Secrets(secret.Namespace).Get(context.Background(), secret.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.K8S.CoreV1().Secrets(secret.Namespace).Create(context.Background(), secret, metav1.CreateOptions{})
+		return err
+	} else if err != nil {
+		return err
+	}
+	current.Labels = secret.Labels
+	current.Data = secret.Data
+	_, err = client.K8S.CoreV1().Secrets(secret.Namespace).Update(context.Background(), current, metav1.UpdateOptions{})
+	return err
+}
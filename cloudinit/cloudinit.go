@@ -2,32 +2,30 @@ package cloudinit
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	defaultSudo      = "ALL=(ALL) NOPASSWD:ALL"
+	defaultDNSServer = "172.29.131.60"
+)
+
 type cloudInit struct {
 	Hostname       string            `yaml:"hostname"`
 	ManageEtcHosts bool              `yaml:"manage_etc_hosts"`
 	Users          []instanceUser    `yaml:"users"`
 	SSHPwauth      bool              `yaml:"ssh_pwauth"`
 	DisableRoot    bool              `yaml:"disable_root"`
-	Chpasswd       chpasswd          `yaml:"chpasswd"`
+	Chpasswd       *chpasswd         `yaml:"chpasswd,omitempty"`
+	NTP            *ntp              `yaml:"ntp,omitempty"`
+	Packages       []string          `yaml:"packages,omitempty"`
 	WriteFiles     []writeFiles      `yaml:"write_files"`
 	RunCMD         []string          `yaml:"runcmd"`
 	APT            map[string]source `yaml:"apt"`
 	Snap           map[string]string `yaml:"snap"`
-	Network        netw              `yaml:"network"`
-}
-
-type netw struct {
-	Version   string              `yaml:"version"`
-	Ethernets map[string]ethernet `yaml:"ethernets"`
-}
-
-type ethernet struct {
-	Match map[string]string `yaml:"match"`
-	Dhcp4 bool              `yaml:"dhcp4"`
 }
 
 type source struct {
@@ -40,60 +38,111 @@ type chpasswd struct {
 	Expire bool   `yaml:"expire"`
 }
 
+type ntp struct {
+	Enabled bool     `yaml:"enabled"`
+	Servers []string `yaml:"servers"`
+}
+
 type writeFiles struct {
-	Content string `yaml:"content"`
-	Path    string `yaml:"path"`
+	Content     string `yaml:"content"`
+	Path        string `yaml:"path"`
+	Permissions string `yaml:"permissions,omitempty"`
+	Owner       string `yaml:"owner,omitempty"`
 }
 
 type instanceUser struct {
 	Name              string   `yaml:"name"`
 	Sudo              string   `yaml:"sudo"`
-	Groups            string   `yaml:"groups"`
-	Home              string   `yaml:"home"`
-	Shell             string   `yaml:"shell"`
+	Groups            string   `yaml:"groups,omitempty"`
+	Home              string   `yaml:"home,omitempty"`
+	Shell             string   `yaml:"shell,omitempty"`
 	LockPasswd        bool     `yaml:"lock_passwd"`
+	Passwd            string   `yaml:"passwd,omitempty"`
 	SSHAuthorizedKeys []string `yaml:"ssh-authorized-keys"`
 }
 
-func CreateCloudInit(hostname, key string) (string, error) {
+// CreateCloudInit renders the cloud-config user data of a node. Without
+// configured users it creates the contrail and root users with the password
+// contrail, unless password authentication is disabled.
+func CreateCloudInit(hostname, key string, config cluster.Cloudinit) (string, error) {
 	ci := cloudInit{
 		Hostname:       hostname,
 		ManageEtcHosts: true,
-		Users: []instanceUser{{
+		SSHPwauth:      !config.Disablepasswordauth,
+		DisableRoot:    false,
+		Packages:       config.Packages,
+	}
+	if len(config.Users) == 0 {
+		ci.Users = []instanceUser{{
 			Name:              "contrail",
-			Sudo:              "ALL=(ALL) NOPASSWD:ALL",
+			Sudo:              defaultSudo,
 			Home:              "/home/contrail",
 			Shell:             "/bin/bash",
-			LockPasswd:        false,
+			LockPasswd:        config.Disablepasswordauth,
 			SSHAuthorizedKeys: []string{key},
 		}, {
 			Name:              "root",
-			Sudo:              "ALL=(ALL) NOPASSWD:ALL",
+			Sudo:              defaultSudo,
+			LockPasswd:        config.Disablepasswordauth,
 			SSHAuthorizedKeys: []string{key},
-		}},
-		SSHPwauth:   true,
-		DisableRoot: false,
-		Chpasswd: chpasswd{
-			List: `contrail:contrail
+		}}
+		if !config.Disablepasswordauth {
+			ci.Chpasswd = &chpasswd{
+				List: `contrail:contrail
 root:contrail`,
-			Expire: false,
-		},
-		WriteFiles: []writeFiles{{
-			Content: `[Resolve]
-DNS=172.29.131.60`,
-			Path: "/etc/systemd/resolved.conf",
-		}, {
-			Content: `network:
-  ethernets:
-    enp2s0:
-      dhcp4: true`,
-			Path: "/etc/netplan/intf.yaml",
-		}},
-		RunCMD: []string{
-			"systemctl restart systemd-resolved.service",
-			"netplan apply",
-		},
+				Expire: false,
+			}
+		}
+	}
+	for _, user := range config.Users {
+		ciUser := instanceUser{
+			Name:              user.Name,
+			Sudo:              user.Sudo,
+			Groups:            user.Groups,
+			Shell:             user.Shell,
+			LockPasswd:        config.Disablepasswordauth || user.Passwd == "",
+			SSHAuthorizedKeys: append([]string{key}, user.Sshauthorizedkeys...),
+		}
+		if ciUser.Sudo == "" {
+			ciUser.Sudo = defaultSudo
+		}
+		if !config.Disablepasswordauth {
+			ciUser.Passwd = user.Passwd
+		}
+		if user.Name != "root" {
+			ciUser.Home = "/home/" + user.Name
+		}
+		ci.Users = append(ci.Users, ciUser)
+	}
+	if len(config.Ntpservers) > 0 {
+		ci.NTP = &ntp{
+			Enabled: true,
+			Servers: config.Ntpservers,
+		}
+	}
+	dnsServers := config.Dnsservers
+	if len(dnsServers) == 0 {
+		dnsServers = []string{defaultDNSServer}
+	}
+	resolved := fmt.Sprintf("[Resolve]\nDNS=%s", strings.Join(dnsServers, " "))
+	if len(config.Dnssearch) > 0 {
+		resolved = fmt.Sprintf("%s\nDomains=%s", resolved, strings.Join(config.Dnssearch, " "))
+	}
+	ci.WriteFiles = []writeFiles{{
+		Content: resolved,
+		Path:    "/etc/systemd/resolved.conf",
+	}}
+	for _, file := range config.Writefiles {
+		ci.WriteFiles = append(ci.WriteFiles, writeFiles{
+			Content:     file.Content,
+			Path:        file.Path,
+			Permissions: file.Permissions,
+			Owner:       file.Owner,
+		})
 	}
+	ci.RunCMD = append([]string{
+		"systemctl restart systemd-resolved.service",
+	}, config.Runcmd...)
 
 	ciByte, err := yaml.Marshal(&ci)
 	if err != nil {
@@ -0,0 +1,68 @@
+package cloudinit
+
+import (
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"gopkg.in/yaml.v3"
+)
+
+// Interface is a node NIC, matched by its MAC address in the guest.
+type Interface struct {
+	// Name is the netplan id of the NIC.
+	Name       string
+	Macaddress string
+	// Address is a static address in CIDR notation, DHCP is used if empty.
+	Address string
+	Config  cluster.Interface
+}
+
+type networkData struct {
+	Version   int                 `yaml:"version"`
+	Ethernets map[string]ethernet `yaml:"ethernets"`
+}
+
+type ethernet struct {
+	Match     map[string]string `yaml:"match"`
+	Dhcp4     bool              `yaml:"dhcp4"`
+	Addresses []string          `yaml:"addresses,omitempty"`
+	Mtu       int               `yaml:"mtu,omitempty"`
+	Routes    []route           `yaml:"routes,omitempty"`
+}
+
+type route struct {
+	To     string `yaml:"to"`
+	Via    string `yaml:"via"`
+	Metric int    `yaml:"metric,omitempty"`
+}
+
+// CreateNetworkData renders the netplan v2 network data of a node.
+func CreateNetworkData(interfaces []Interface) (string, error) {
+	nd := networkData{
+		Version:   2,
+		Ethernets: make(map[string]ethernet),
+	}
+	for _, iface := range interfaces {
+		eth := ethernet{
+			Match: map[string]string{
+				"macaddress": iface.Macaddress,
+			},
+			Dhcp4: iface.Address == "",
+			Mtu:   iface.Config.Mtu,
+		}
+		if iface.Address != "" {
+			eth.Addresses = []string{iface.Address}
+		}
+		for _, r := range iface.Config.Routes {
+			eth.Routes = append(eth.Routes, route{
+				To:     r.To,
+				Via:    r.Via,
+				Metric: r.Metric,
+			})
+		}
+		nd.Ethernets[iface.Name] = eth
+	}
+	ndByte, err := yaml.Marshal(&nd)
+	if err != nil {
+		return "", err
+	}
+	return string(ndByte), nil
+}
@@ -0,0 +1,109 @@
+package cloudinit
+
+import (
+	"testing"
+
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+)
+
+func TestCreateNetworkData(t *testing.T) {
+	tests := []struct {
+		name       string
+		interfaces []Interface
+		want       string
+	}{{
+		name: "dhcp",
+		interfaces: []Interface{{
+			Name:       "default",
+			Macaddress: "02:00:00:00:00:01",
+		}},
+		want: `version: 2
+ethernets:
+    default:
+        match:
+            macaddress: "02:00:00:00:00:01"
+        dhcp4: true
+`,
+	}, {
+		name: "static address",
+		interfaces: []Interface{{
+			Name:       "cluster1",
+			Macaddress: "02:00:00:00:00:02",
+			Address:    "10.0.0.10/24",
+		}},
+		want: `version: 2
+ethernets:
+    cluster1:
+        match:
+            macaddress: "02:00:00:00:00:02"
+        dhcp4: false
+        addresses:
+            - 10.0.0.10/24
+`,
+	}, {
+		name: "mtu and routes",
+		interfaces: []Interface{{
+			Name:       "storage",
+			Macaddress: "02:00:00:00:00:03",
+			Config: cluster.Interface{
+				Mtu: 9000,
+				Routes: []cluster.Route{{
+					To:  "192.168.0.0/16",
+					Via: "10.1.0.1",
+				}, {
+					To:     "default",
+					Via:    "10.1.0.254",
+					Metric: 200,
+				}},
+			},
+		}},
+		want: `version: 2
+ethernets:
+    storage:
+        match:
+            macaddress: "02:00:00:00:00:03"
+        dhcp4: true
+        mtu: 9000
+        routes:
+            - to: 192.168.0.0/16
+              via: 10.1.0.1
+            - to: default
+              via: 10.1.0.254
+              metric: 200
+`,
+	}, {
+		name: "several interfaces",
+		interfaces: []Interface{{
+			Name:       "default",
+			Macaddress: "02:00:00:00:00:01",
+		}, {
+			Name:       "cluster1",
+			Macaddress: "02:00:00:00:00:02",
+			Address:    "10.0.0.10/24",
+		}},
+		want: `version: 2
+ethernets:
+    cluster1:
+        match:
+            macaddress: "02:00:00:00:00:02"
+        dhcp4: false
+        addresses:
+            - 10.0.0.10/24
+    default:
+        match:
+            macaddress: "02:00:00:00:00:01"
+        dhcp4: true
+`,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CreateNetworkData(tt.interfaces)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CreateNetworkData() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
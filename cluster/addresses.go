@@ -0,0 +1,88 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+const (
+	// defaultAddressOffset keeps the first addresses of Subnet free for the
+	// network address, the gateway and infrastructure.
+	defaultAddressOffset = 10
+	// defaultWorkerAddressOffset is the first worker address of a cluster
+	// without node pools, adding controllers doesn't move the workers.
+	defaultWorkerAddressOffset = 50
+)
+
+// NodeAddresses returns the static addresses of the nodes on the cluster
+// network in CIDR notation. Nodes without a static address are not included.
+func (c *Cluster) NodeAddresses() (map[string]string, error) {
+	return c.staticAddresses(c.Interfaces.Cluster, c.Subnet)
+}
+
+// NetworkAddresses returns the static addresses of the nodes on a secondary
+// network.
+func (c *Cluster) NetworkAddresses(network Network) (map[string]string, error) {
+	return c.staticAddresses(network.Interface, network.Subnet)
+}
+
+// staticAddresses returns the pinned addresses of iface and, if enabled,
+// addresses derived from subnet for all other nodes.
+func (c *Cluster) staticAddresses(iface Interface, subnet string) (map[string]string, error) {
+	addresses := make(map[string]string)
+	for node, address := range iface.Addresses {
+		addresses[node] = address
+	}
+	if !iface.Static {
+		return addresses, nil
+	}
+	_, ipnet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return nil, err
+	}
+	ones, _ := ipnet.Mask.Size()
+	pools := c.NodePools()
+	for _, pool := range pools {
+		if pool.Count == 0 {
+			continue
+		}
+		// every pool has its own base, resizing a pool doesn't move the
+		// addresses of the others
+		offset := pool.Addressoffset
+		if offset == 0 {
+			if len(pools) > 1 {
+				return nil, fmt.Errorf("node pool %s needs an addressoffset, there are several node pools", pool.Name)
+			}
+			offset = defaultAddressOffset
+		}
+		for idx := 0; idx < pool.Count; idx++ {
+			node := NodeName(pool, idx)
+			if _, ok := addresses[node]; !ok {
+				ip, err := nthAddress(ipnet, offset+idx)
+				if err != nil {
+					return nil, fmt.Errorf("cannot derive address of node %s: %s", node, err)
+				}
+				addresses[node] = fmt.Sprintf("%s/%d", ip, ones)
+			}
+		}
+	}
+	return addresses, nil
+}
+
+// nthAddress returns the address at position n of an IPv4 subnet, leaving
+// out the broadcast address.
+func nthAddress(ipnet *net.IPNet, n int) (net.IP, error) {
+	base := ipnet.IP.To4()
+	if base == nil {
+		return nil, fmt.Errorf("%s is not an IPv4 subnet", ipnet)
+	}
+	ones, bits := ipnet.Mask.Size()
+	size := uint64(1) << uint(bits-ones)
+	if n < 1 || uint64(n) >= size-1 {
+		return nil, fmt.Errorf("position %d is outside of %s", n, ipnet)
+	}
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(base)+uint32(n))
+	return ip, nil
+}
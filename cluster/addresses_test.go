@@ -0,0 +1,184 @@
+package cluster
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/michaelhenkel/cn2kubevirt/roles"
+)
+
+func TestStaticAddresses(t *testing.T) {
+	tests := []struct {
+		name    string
+		cluster Cluster
+		iface   Interface
+		want    map[string]string
+		wantErr bool
+	}{{
+		name:    "not static",
+		cluster: Cluster{Controller: 1, Worker: 1},
+		iface:   Interface{Addresses: map[string]string{"worker-0": "10.0.0.100/24"}},
+		want:    map[string]string{"worker-0": "10.0.0.100/24"},
+	}, {
+		name:    "implicit pools",
+		cluster: Cluster{Controller: 3, Worker: 2},
+		iface:   Interface{Static: true},
+		want: map[string]string{
+			"controller-0": "10.0.0.10/24",
+			"controller-1": "10.0.0.11/24",
+			"controller-2": "10.0.0.12/24",
+			"worker-0":     "10.0.0.50/24",
+			"worker-1":     "10.0.0.51/24",
+		},
+	}, {
+		name:    "more controllers keep the worker addresses",
+		cluster: Cluster{Controller: 5, Worker: 1},
+		iface:   Interface{Static: true},
+		want: map[string]string{
+			"controller-0": "10.0.0.10/24",
+			"controller-1": "10.0.0.11/24",
+			"controller-2": "10.0.0.12/24",
+			"controller-3": "10.0.0.13/24",
+			"controller-4": "10.0.0.14/24",
+			"worker-0":     "10.0.0.50/24",
+		},
+	}, {
+		name:    "pinned address",
+		cluster: Cluster{Controller: 2},
+		iface: Interface{
+			Static:    true,
+			Addresses: map[string]string{"controller-1": "10.0.0.200/24"},
+		},
+		want: map[string]string{
+			"controller-0": "10.0.0.10/24",
+			"controller-1": "10.0.0.200/24",
+		},
+	}, {
+		name: "single pool",
+		cluster: Cluster{Pools: []NodePool{{
+			Role:  roles.Controller,
+			Count: 2,
+		}}},
+		iface: Interface{Static: true},
+		want: map[string]string{
+			"controller-0": "10.0.0.10/24",
+			"controller-1": "10.0.0.11/24",
+		},
+	}, {
+		name: "pool offsets",
+		cluster: Cluster{Pools: []NodePool{{
+			Role:          roles.Controller,
+			Count:         1,
+			Addressoffset: 20,
+		}, {
+			Name:          "large",
+			Role:          roles.Worker,
+			Count:         2,
+			Addressoffset: 100,
+		}}},
+		iface: Interface{Static: true},
+		want: map[string]string{
+			"controller-0": "10.0.0.20/24",
+			"large-0":      "10.0.0.100/24",
+			"large-1":      "10.0.0.101/24",
+		},
+	}, {
+		name: "several pools without offset",
+		cluster: Cluster{Pools: []NodePool{{
+			Role:  roles.Controller,
+			Count: 1,
+		}, {
+			Role:  roles.Worker,
+			Count: 1,
+		}}},
+		iface:   Interface{Static: true},
+		wantErr: true,
+	}, {
+		name: "empty pool needs no offset",
+		cluster: Cluster{Pools: []NodePool{{
+			Role:          roles.Controller,
+			Count:         1,
+			Addressoffset: 10,
+		}, {
+			Role: roles.Worker,
+		}}},
+		iface: Interface{Static: true},
+		want:  map[string]string{"controller-0": "10.0.0.10/24"},
+	}, {
+		name: "outside of the subnet",
+		cluster: Cluster{Pools: []NodePool{{
+			Role:          roles.Controller,
+			Count:         2,
+			Addressoffset: 254,
+		}}},
+		iface:   Interface{Static: true},
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cluster.staticAddresses(tt.iface, "10.0.0.0/24")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("staticAddresses() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("staticAddresses() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNthAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		subnet  string
+		n       int
+		want    string
+		wantErr bool
+	}{{
+		name:   "first host",
+		subnet: "10.0.0.0/24",
+		n:      1,
+		want:   "10.0.0.1",
+	}, {
+		name:   "last host",
+		subnet: "10.0.0.0/24",
+		n:      254,
+		want:   "10.0.0.254",
+	}, {
+		name:   "beyond an octet",
+		subnet: "10.0.0.0/16",
+		n:      300,
+		want:   "10.0.1.44",
+	}, {
+		name:    "network address",
+		subnet:  "10.0.0.0/24",
+		n:       0,
+		wantErr: true,
+	}, {
+		name:    "broadcast address",
+		subnet:  "10.0.0.0/24",
+		n:       255,
+		wantErr: true,
+	}, {
+		name:    "IPv6",
+		subnet:  "fd00::/64",
+		n:       1,
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ipnet, err := net.ParseCIDR(tt.subnet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := nthAddress(ipnet, tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nthAddress() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("nthAddress() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
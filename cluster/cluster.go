@@ -1,12 +1,25 @@
 package cluster
 
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/michaelhenkel/cn2kubevirt/roles"
+	hd "github.com/mitchellh/go-homedir"
+)
+
 type Cluster struct {
-	Name            string
-	Namespace       string
-	Controller      int
-	Worker          int
-	Subnet          string
-	Keypath         string
+	Name       string
+	Namespace  string
+	Controller int
+	Worker     int
+	Subnet     string
+	Keypath    string
+	// Key is the public key itself and takes precedence over Keypath, so
+	// the cluster doesn't depend on local files.
+	Key             string
 	Memory          string
 	Cpu             string
 	Image           string
@@ -17,4 +30,372 @@ type Cluster struct {
 	Servicev4subnet string
 	Servicev6subnet string
 	Asn             int
+	// Vmi creates bare VirtualMachineInstances instead of VirtualMachines.
+	Vmi bool
+	// Runstrategy is the RunStrategy of the VirtualMachines, defaults to Always.
+	Runstrategy string
+	Disk        Disk
+	Readiness   Readiness
+	Ssh         SSH
+	Kubespray   Kubespray
+	Images      Images
+	Cloudinit   Cloudinit
+	Interfaces  Interfaces
+	// Networks are attached to every node in addition to the pod and the
+	// cluster network.
+	Networks []Network
+	// Storeartifacts copies inventory, deployer manifest and kubeconfig to
+	// ConfigMaps and a Secret in the cluster namespace.
+	Storeartifacts bool
+	// Cni selects the CNI of the cluster and secondary networks on the
+	// host cluster.
+	Cni Cni
+	// Expose makes the API server reachable from outside the host cluster.
+	Expose Expose
+	// Pools replace Controller, Worker, Cpu, Memory, Image and Disk with
+	// individually sized groups of nodes.
+	Pools []NodePool `yaml:"nodePools"`
+}
+
+// NodePool is a group of nodes sharing role and sizing. Empty fields are
+// taken from the cluster.
+type NodePool struct {
+	// Name prefixes the node names, defaults to the role.
+	Name   string
+	Role   roles.Role
+	Count  int
+	Cpu    string
+	Memory string
+	Image  string
+	Labels map[string]string
+	Disk   Disk
+	// Addressoffset is the position in Subnet of the derived address of
+	// the first node. It is needed for static addresses if there are
+	// several pools, a single pool starts at the default offset.
+	Addressoffset int
+}
+
+// NodePools returns the node pools of the cluster with defaults applied. A
+// cluster without node pools gets one controller and one worker pool.
+func (c *Cluster) NodePools() []NodePool {
+	pools := c.Pools
+	if len(pools) == 0 {
+		pools = []NodePool{{
+			Role:          roles.Controller,
+			Count:         c.Controller,
+			Addressoffset: defaultAddressOffset,
+		}, {
+			Role:          roles.Worker,
+			Count:         c.Worker,
+			Addressoffset: defaultWorkerAddressOffset,
+		}}
+	}
+	var nodePools []NodePool
+	for _, pool := range pools {
+		if pool.Name == "" {
+			pool.Name = string(pool.Role)
+		}
+		if pool.Cpu == "" {
+			pool.Cpu = c.Cpu
+		}
+		if pool.Memory == "" {
+			pool.Memory = c.Memory
+		}
+		if pool.Image == "" {
+			pool.Image = c.Image
+		}
+		if pool.Disk.Mode == "" {
+			pool.Disk.Mode = c.Disk.Mode
+		}
+		if pool.Disk.Size == "" {
+			pool.Disk.Size = c.Disk.Size
+		}
+		if pool.Disk.Storageclass == "" {
+			pool.Disk.Storageclass = c.Disk.Storageclass
+		}
+		if pool.Disk.Sourcepvc == "" {
+			pool.Disk.Sourcepvc = c.Disk.Sourcepvc
+		}
+		nodePools = append(nodePools, pool)
+	}
+	return nodePools
+}
+
+// Count returns the number of nodes with the given role over all node pools.
+func (c *Cluster) Count(role roles.Role) int {
+	count := 0
+	for _, pool := range c.NodePools() {
+		if pool.Role == role {
+			count += pool.Count
+		}
+	}
+	return count
+}
+
+type Readiness struct {
+	// Timeout bounds the wait for all nodes to become ready, defaults to 30m.
+	Timeout string
+	// Skipguestagent only waits for the Ready condition of the nodes, for
+	// images without qemu-guest-agent.
+	Skipguestagent bool
+}
+
+type SSH struct {
+	// Skip disables the SSH reachability check after the nodes are ready.
+	Skip bool
+	// User defaults to root, the ansible_user of the inventory.
+	User string
+	// Privatekeypath defaults to Keypath without the .pub suffix.
+	Privatekeypath string
+	// Jumphost is a user@host:port bastion used when the node IPs are not
+	// directly routable.
+	Jumphost string
+	// Cloudinit waits for cloud-init status --wait to succeed on every node.
+	Cloudinit bool
+}
+
+type Kubespray struct {
+	// Image is the kubespray image run by the install Job.
+	Image string
+	// Imagerepo is the docker_image_repo of the inventory, defaults to
+	// svl-artifactory.juniper.net/atom-docker-remote.
+	Imagerepo string
+}
+
+// Cloudinit configures the cloud-init user data of all nodes.
+type Cloudinit struct {
+	// Users replace the default contrail and root users. The public key
+	// of Keypath is authorized for every user.
+	Users []User
+	// Disablepasswordauth disables SSH password authentication and locks
+	// the passwords of all users.
+	Disablepasswordauth bool
+	// Dnsservers defaults to 172.29.131.60.
+	Dnsservers []string
+	Dnssearch  []string
+	Ntpservers []string
+	Writefiles []File
+	// Runcmd is run after DNS is configured.
+	Runcmd   []string
+	Packages []string
+}
+
+type User struct {
+	Name string
+	// Sudo defaults to ALL=(ALL) NOPASSWD:ALL.
+	Sudo   string
+	Groups string
+	Shell  string
+	// Passwd is a crypt hash, e.g. from mkpasswd -m sha-512.
+	Passwd            string
+	Sshauthorizedkeys []string
+}
+
+type File struct {
+	Path        string
+	Content     string
+	Permissions string
+	Owner       string
+}
+
+// Interfaces configures the guest side of the node NICs, rendered as
+// cloud-init network data.
+type Interfaces struct {
+	// Pod is the interface on the pod network.
+	Pod Interface
+	// Cluster is the interface on the cluster network.
+	Cluster Interface
+}
+
+type Interface struct {
+	Mtu int
+	// Addresses maps node names to static addresses in CIDR notation.
+	// Nodes without an address use DHCP. Static addresses need the bridge
+	// or macvlan cni provider.
+	Addresses map[string]string
+	// Static derives the addresses of all nodes which are not in Addresses
+	// from the subnet and the node index.
+	Static bool
+	Routes []Route
+}
+
+type CniProvider string
+
+const (
+	// CN2 attaches the nodes to CN2 virtual networks, it needs a CN2 host.
+	CN2 CniProvider = "cn2"
+	// Bridge attaches the nodes to a Linux bridge on the hosts.
+	Bridge CniProvider = "bridge"
+	// Macvlan attaches the nodes to a host interface with macvlan.
+	Macvlan CniProvider = "macvlan"
+	// OVNKubernetes attaches the nodes to OVN-Kubernetes layer2 secondary
+	// networks, which assign the addresses themselves.
+	OVNKubernetes CniProvider = "ovn-k8s"
+)
+
+type Ipam string
+
+const (
+	// Whereabouts assigns addresses cluster-wide.
+	Whereabouts Ipam = "whereabouts"
+	// HostLocal assigns addresses per host, which is only safe if all
+	// nodes run on a single host.
+	HostLocal Ipam = "host-local"
+)
+
+type Cni struct {
+	// Provider defaults to cn2.
+	Provider CniProvider
+	// Bridge is the host bridge of the bridge provider.
+	Bridge string
+	// Master is the host interface of the macvlan provider.
+	Master string
+	// Mode is the macvlan mode, defaults to bridge.
+	Mode string
+	// Vlan tags the traffic of the bridge provider.
+	Vlan int
+	// Ipam assigns the addresses of the bridge and macvlan providers,
+	// defaults to whereabouts. Nodes with static addresses use the static
+	// IPAM instead.
+	Ipam Ipam
+}
+
+type ExposeType string
+
+const (
+	// ExposeNodePort exposes the API server on a node port of the hosts.
+	ExposeNodePort ExposeType = "nodeport"
+	// ExposeLoadBalancer exposes the API server on a LoadBalancer service,
+	// e.g. announced by MetalLB.
+	ExposeLoadBalancer ExposeType = "loadbalancer"
+	// ExposeIngress exposes the API server on an Ingress with TLS
+	// passthrough, which needs ingress-nginx with --enable-ssl-passthrough.
+	ExposeIngress ExposeType = "ingress"
+	// ExposeRoute exposes the API server on an OpenShift Route with TLS
+	// passthrough.
+	ExposeRoute ExposeType = "route"
+)
+
+type Expose struct {
+	// Type defaults to none, which keeps the API service ClusterIP only.
+	Type ExposeType
+	// Host is the hostname of the Ingress or Route. For nodeport it is
+	// the address clients connect to, defaults to the first host node.
+	Host string
+	// Nodeport pins the node port, defaults to one picked by Kubernetes.
+	Nodeport int32
+	// Loadbalancerip requests a fixed LoadBalancer address.
+	Loadbalancerip string
+	// Ingressclass is the IngressClass of the Ingress.
+	Ingressclass string
+	// Annotations are added to the Service, Ingress or Route, e.g.
+	// metallb.universe.tf/address-pool.
+	Annotations map[string]string
+}
+
+// Network is a secondary network with its own NetworkAttachmentDefinition
+// and subnet.
+type Network struct {
+	// Name is the name of the interface, the NetworkAttachmentDefinition
+	// is named <cluster>-<name>.
+	Name      string
+	Subnet    string
+	Interface Interface
+}
+
+type Route struct {
+	To     string
+	Via    string
+	Metric int
+}
+
+// NodeNames returns the names of all nodes of the cluster.
+func (c *Cluster) NodeNames() []string {
+	var names []string
+	for _, pool := range c.NodePools() {
+		for idx := 0; idx < pool.Count; idx++ {
+			names = append(names, NodeName(pool, idx))
+		}
+	}
+	return names
+}
+
+// NodeName returns the name of the node with index idx in pool.
+func NodeName(pool NodePool, idx int) string {
+	return fmt.Sprintf("%s-%d", pool.Name, idx)
+}
+
+// Images overrides where the CN2 images are pulled from.
+type Images struct {
+	// Registry replaces the repository prefix of all CN2 images.
+	Registry string
+	// Tag replaces the tag of all CN2 images, defaults to latest.
+	Tag string
+	// Overrides maps CN2 component names like contrail-k8s-apiserver to
+	// full image references and take precedence over Registry and Tag.
+	Overrides map[string]string
+	// Pullsecrets are referenced as imagePullSecrets by all CN2 pods and
+	// must exist in the contrail and contrail-deploy namespaces.
+	Pullsecrets []string
+}
+
+// SSHUser returns the user ansible and the reachability check log in with.
+func (c *Cluster) SSHUser() string {
+	if c.Ssh.User != "" {
+		return c.Ssh.User
+	}
+	return "root"
+}
+
+// PublicKey returns Key or else the content of Keypath.
+func (c *Cluster) PublicKey() (string, error) {
+	if c.Key != "" {
+		return c.Key, nil
+	}
+	keypath, err := hd.Expand(c.Keypath)
+	if err != nil {
+		return "", err
+	}
+	key, err := os.ReadFile(keypath)
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
+
+// PrivateKeypath returns the private key matching Keypath.
+func (c *Cluster) PrivateKeypath() string {
+	if c.Ssh.Privatekeypath != "" {
+		return c.Ssh.Privatekeypath
+	}
+	return strings.TrimSuffix(c.Keypath, ".pub")
+}
+
+const defaultReadinessTimeout = 30 * time.Minute
+
+// ReadinessTimeout returns the parsed readiness timeout or its default.
+func (c *Cluster) ReadinessTimeout() time.Duration {
+	if timeout, err := time.ParseDuration(c.Readiness.Timeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return defaultReadinessTimeout
+}
+
+type DiskMode string
+
+const (
+	// ContainerDisk boots every node from an ephemeral copy of Image.
+	ContainerDisk DiskMode = "containerdisk"
+	// DataVolume imports Image, or clones Sourcepvc, into a persistent
+	// DataVolume per node.
+	DataVolume DiskMode = "datavolume"
+)
+
+type Disk struct {
+	Mode         DiskMode
+	Size         string
+	Storageclass string
+	// Sourcepvc is a namespace/name reference to a golden PVC which is
+	// cloned instead of importing Image.
+	Sourcepvc string
 }
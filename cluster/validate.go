@@ -0,0 +1,467 @@
+package cluster
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/michaelhenkel/cn2kubevirt/roles"
+	hd "github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/ssh"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const maxAsn = 4294967295
+
+var runStrategies = []string{"Always", "RerunOnFailure", "Manual", "Halted"}
+
+var (
+	cniProviders = []string{string(CN2), string(Bridge), string(Macvlan), string(OVNKubernetes)}
+	ipams        = []string{string(Whereabouts), string(HostLocal)}
+	macvlanModes = []string{"bridge", "private", "vepa", "passthru"}
+	exposeTypes  = []string{string(ExposeNodePort), string(ExposeLoadBalancer), string(ExposeIngress), string(ExposeRoute)}
+)
+
+// Validate checks the cluster spec before anything is created and returns
+// all problems found as a single error.
+func (c *Cluster) Validate() error {
+	var errList field.ErrorList
+	errList = append(errList, validateName(field.NewPath("name"), c.Name)...)
+	errList = append(errList, validateName(field.NewPath("namespace"), c.Namespace)...)
+	if c.Kubeconfigdir == "" {
+		errList = append(errList, field.Required(field.NewPath("kubeconfigdir"), ""))
+	}
+	if c.Asn < 1 || int64(c.Asn) > maxAsn {
+		errList = append(errList, field.Invalid(field.NewPath("asn"), c.Asn, fmt.Sprintf("must be between 1 and %d", maxAsn)))
+	}
+	if c.Key != "" {
+		if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(c.Key)); err != nil {
+			errList = append(errList, field.Invalid(field.NewPath("key"), c.Key, err.Error()))
+		}
+	} else if c.Keypath == "" {
+		errList = append(errList, field.Required(field.NewPath("keypath"), "keypath or key is required"))
+	} else if keypath, err := hd.Expand(c.Keypath); err != nil {
+		errList = append(errList, field.Invalid(field.NewPath("keypath"), c.Keypath, err.Error()))
+	} else if _, err := os.Stat(keypath); err != nil {
+		errList = append(errList, field.Invalid(field.NewPath("keypath"), c.Keypath, "key file not readable"))
+	}
+	if c.Runstrategy != "" && !contains(runStrategies, c.Runstrategy) {
+		errList = append(errList, field.NotSupported(field.NewPath("runstrategy"), c.Runstrategy, runStrategies))
+	}
+	if c.Readiness.Timeout != "" {
+		if timeout, err := time.ParseDuration(c.Readiness.Timeout); err != nil || timeout <= 0 {
+			errList = append(errList, field.Invalid(field.NewPath("readiness").Child("timeout"), c.Readiness.Timeout, "must be a positive duration like 30m"))
+		}
+	}
+	errList = append(errList, c.validateImages()...)
+	errList = append(errList, c.validateCloudinit()...)
+	errList = append(errList, c.validateInterface(field.NewPath("interfaces").Child("pod"), c.Interfaces.Pod, "")...)
+	errList = append(errList, c.validateInterface(field.NewPath("interfaces").Child("cluster"), c.Interfaces.Cluster, c.Subnet)...)
+	errList = append(errList, c.validateAddresses(field.NewPath("interfaces").Child("cluster"), c.Interfaces.Cluster, c.Subnet)...)
+	errList = append(errList, c.validateNetworks()...)
+	errList = append(errList, c.validateCni()...)
+	errList = append(errList, c.validateExpose()...)
+	errList = append(errList, c.validateSubnets()...)
+	errList = append(errList, c.validateNodePools()...)
+	if len(errList) == 0 {
+		return nil
+	}
+	var msgs []string
+	var seen = make(map[string]struct{})
+	for _, err := range errList {
+		// implicit node pools share the cluster fields and report the
+		// same problem for controllers and workers.
+		if _, ok := seen[err.Error()]; ok {
+			continue
+		}
+		seen[err.Error()] = struct{}{}
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Errorf("invalid cluster %s:\n  %s", c.Name, strings.Join(msgs, "\n  "))
+}
+
+var imageTag = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+
+func (c *Cluster) validateImages() field.ErrorList {
+	var errList field.ErrorList
+	path := field.NewPath("images")
+	if c.Images.Tag != "" && !imageTag.MatchString(c.Images.Tag) {
+		errList = append(errList, field.Invalid(path.Child("tag"), c.Images.Tag, "must be a valid image tag"))
+	}
+	for component, image := range c.Images.Overrides {
+		if image == "" {
+			errList = append(errList, field.Required(path.Child("overrides").Key(component), ""))
+		}
+	}
+	for idx, secret := range c.Images.Pullsecrets {
+		for _, msg := range validation.IsDNS1123Subdomain(secret) {
+			errList = append(errList, field.Invalid(path.Child("pullsecrets").Index(idx), secret, msg))
+		}
+	}
+	return errList
+}
+
+func (c *Cluster) validateCloudinit() field.ErrorList {
+	var errList field.ErrorList
+	path := field.NewPath("cloudinit")
+	var names []string
+	for idx, user := range c.Cloudinit.Users {
+		userPath := path.Child("users").Index(idx)
+		if user.Name == "" {
+			errList = append(errList, field.Required(userPath.Child("name"), ""))
+		} else if contains(names, user.Name) {
+			errList = append(errList, field.Duplicate(userPath.Child("name"), user.Name))
+		}
+		names = append(names, user.Name)
+		if user.Passwd != "" && !strings.HasPrefix(user.Passwd, "$") {
+			errList = append(errList, field.Invalid(userPath.Child("passwd"), "<redacted>", "must be a crypt hash like $6$..., not a plaintext password"))
+		}
+	}
+	if len(names) > 0 && !contains(names, c.SSHUser()) {
+		errList = append(errList, field.Invalid(path.Child("users"), names, fmt.Sprintf("must contain the ssh user %s", c.SSHUser())))
+	}
+	for idx, server := range c.Cloudinit.Dnsservers {
+		if net.ParseIP(server) == nil {
+			errList = append(errList, field.Invalid(path.Child("dnsservers").Index(idx), server, "must be an IP address"))
+		}
+	}
+	for idx, file := range c.Cloudinit.Writefiles {
+		if !strings.HasPrefix(file.Path, "/") {
+			errList = append(errList, field.Invalid(path.Child("writefiles").Index(idx).Child("path"), file.Path, "must be an absolute path"))
+		}
+	}
+	return errList
+}
+
+// validateInterface validates the guest config of a NIC. Static addresses
+// are only supported with a subnet and must be part of it.
+func (c *Cluster) validateInterface(path *field.Path, iface Interface, subnet string) field.ErrorList {
+	var errList field.ErrorList
+	if iface.Mtu != 0 && (iface.Mtu < 576 || iface.Mtu > 9216) {
+		errList = append(errList, field.Invalid(path.Child("mtu"), iface.Mtu, "must be between 576 and 9216"))
+	}
+	var ipnet *net.IPNet
+	if subnet != "" {
+		_, ipnet, _ = net.ParseCIDR(subnet)
+	}
+	if iface.Static && subnet == "" {
+		errList = append(errList, field.Forbidden(path.Child("static"), "static addresses are not supported on this interface"))
+	}
+	nodes := c.NodeNames()
+	for node, address := range iface.Addresses {
+		addressPath := path.Child("addresses").Key(node)
+		if subnet == "" {
+			errList = append(errList, field.Forbidden(addressPath, "static addresses are not supported on this interface"))
+			continue
+		}
+		if !contains(nodes, node) {
+			errList = append(errList, field.NotSupported(addressPath, node, nodes))
+		}
+		ip, _, err := net.ParseCIDR(address)
+		if err != nil {
+			errList = append(errList, field.Invalid(addressPath, address, "must be an address in CIDR notation"))
+		} else if ipnet != nil && !ipnet.Contains(ip) {
+			errList = append(errList, field.Invalid(addressPath, address, fmt.Sprintf("must be part of %s", subnet)))
+		}
+	}
+	for idx, route := range iface.Routes {
+		routePath := path.Child("routes").Index(idx)
+		if _, _, err := net.ParseCIDR(route.To); err != nil && route.To != "default" {
+			errList = append(errList, field.Invalid(routePath.Child("to"), route.To, "must be a CIDR or default"))
+		}
+		if net.ParseIP(route.Via) == nil {
+			errList = append(errList, field.Invalid(routePath.Child("via"), route.Via, "must be an IP address"))
+		}
+		if route.Metric < 0 {
+			errList = append(errList, field.Invalid(routePath.Child("metric"), route.Metric, "must not be negative"))
+		}
+	}
+	return errList
+}
+
+// validateAddresses checks that the static node addresses of an interface
+// can be derived and are unique.
+func (c *Cluster) validateAddresses(path *field.Path, iface Interface, subnet string) field.ErrorList {
+	var errList field.ErrorList
+	if _, _, err := net.ParseCIDR(subnet); err != nil {
+		return errList
+	}
+	addresses, err := c.staticAddresses(iface, subnet)
+	if err != nil {
+		return append(errList, field.Invalid(path.Child("static"), iface.Static, err.Error()))
+	}
+	var nodes []string
+	for node := range addresses {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	var owners = make(map[string]string)
+	for _, node := range nodes {
+		ip, _, err := net.ParseCIDR(addresses[node])
+		if err != nil {
+			continue
+		}
+		if owner, ok := owners[ip.String()]; ok {
+			errList = append(errList, field.Duplicate(path.Child("addresses").Key(node), fmt.Sprintf("%s is also used by %s", ip, owner)))
+		}
+		owners[ip.String()] = node
+	}
+	return errList
+}
+
+func (c *Cluster) validateNetworks() field.ErrorList {
+	var errList field.ErrorList
+	path := field.NewPath("networks")
+	names := []string{"default", c.Name}
+	for idx, network := range c.Networks {
+		networkPath := path.Index(idx)
+		if network.Name == "" {
+			errList = append(errList, field.Required(networkPath.Child("name"), ""))
+		} else if contains(names, network.Name) {
+			errList = append(errList, field.Duplicate(networkPath.Child("name"), network.Name))
+		} else {
+			errList = append(errList, validateName(networkPath.Child("name"), fmt.Sprintf("%s-%s", c.Name, network.Name))...)
+		}
+		names = append(names, network.Name)
+		errList = append(errList, c.validateInterface(networkPath.Child("interface"), network.Interface, network.Subnet)...)
+		errList = append(errList, c.validateAddresses(networkPath.Child("interface"), network.Interface, network.Subnet)...)
+	}
+	return errList
+}
+
+func (c *Cluster) validateCni() field.ErrorList {
+	var errList field.ErrorList
+	path := field.NewPath("cni")
+	switch c.Cni.Provider {
+	case "", CN2, OVNKubernetes:
+	case Bridge:
+		if c.Cni.Bridge == "" {
+			errList = append(errList, field.Required(path.Child("bridge"), "the bridge provider needs a host bridge"))
+		}
+		if c.Cni.Vlan < 0 || c.Cni.Vlan > 4094 {
+			errList = append(errList, field.Invalid(path.Child("vlan"), c.Cni.Vlan, "must be between 0 and 4094"))
+		}
+	case Macvlan:
+		if c.Cni.Master == "" {
+			errList = append(errList, field.Required(path.Child("master"), "the macvlan provider needs a host interface"))
+		}
+		if c.Cni.Mode != "" && !contains(macvlanModes, c.Cni.Mode) {
+			errList = append(errList, field.NotSupported(path.Child("mode"), c.Cni.Mode, macvlanModes))
+		}
+	default:
+		errList = append(errList, field.NotSupported(path.Child("provider"), c.Cni.Provider, cniProviders))
+	}
+	if c.Cni.Ipam != "" && !contains(ipams, string(c.Cni.Ipam)) {
+		errList = append(errList, field.NotSupported(path.Child("ipam"), c.Cni.Ipam, ipams))
+	}
+	// CN2 and OVN-Kubernetes assign the addresses of the pods themselves,
+	// the guest would use another address than the pod
+	if c.Cni.Provider != Bridge && c.Cni.Provider != Macvlan {
+		if len(c.Interfaces.Cluster.Addresses) > 0 || c.Interfaces.Cluster.Static {
+			errList = append(errList, field.Forbidden(field.NewPath("interfaces").Child("cluster"), "static addresses need the bridge or macvlan cni provider"))
+		}
+		for idx, network := range c.Networks {
+			if len(network.Interface.Addresses) > 0 || network.Interface.Static {
+				errList = append(errList, field.Forbidden(field.NewPath("networks").Index(idx).Child("interface"), "static addresses need the bridge or macvlan cni provider"))
+			}
+		}
+	}
+	// host-local can't leave out the pinned addresses of some nodes, only
+	// static addresses for all nodes leave the shared network unused
+	if (c.Cni.Provider == Bridge || c.Cni.Provider == Macvlan) && c.Cni.Ipam == HostLocal {
+		if len(c.Interfaces.Cluster.Addresses) > 0 && !c.Interfaces.Cluster.Static {
+			errList = append(errList, field.Invalid(field.NewPath("interfaces").Child("cluster").Child("static"), false, "pinned addresses with host-local ipam need static addresses for all nodes"))
+		}
+		for idx, network := range c.Networks {
+			if len(network.Interface.Addresses) > 0 && !network.Interface.Static {
+				errList = append(errList, field.Invalid(field.NewPath("networks").Index(idx).Child("interface").Child("static"), false, "pinned addresses with host-local ipam need static addresses for all nodes"))
+			}
+		}
+	}
+	return errList
+}
+
+func (c *Cluster) validateExpose() field.ErrorList {
+	var errList field.ErrorList
+	path := field.NewPath("expose")
+	switch c.Expose.Type {
+	case "":
+		return errList
+	case ExposeNodePort:
+		if c.Expose.Nodeport < 0 || c.Expose.Nodeport > 65535 {
+			errList = append(errList, field.Invalid(path.Child("nodeport"), c.Expose.Nodeport, "must be between 1 and 65535"))
+		}
+	case ExposeLoadBalancer:
+		if c.Expose.Loadbalancerip != "" && net.ParseIP(c.Expose.Loadbalancerip) == nil {
+			errList = append(errList, field.Invalid(path.Child("loadbalancerip"), c.Expose.Loadbalancerip, "must be an IP address"))
+		}
+	case ExposeIngress, ExposeRoute:
+		// the host must be known before kubespray creates the certificates
+		if c.Expose.Host == "" {
+			errList = append(errList, field.Required(path.Child("host"), fmt.Sprintf("%s needs a host", c.Expose.Type)))
+		}
+	default:
+		errList = append(errList, field.NotSupported(path.Child("type"), c.Expose.Type, exposeTypes))
+	}
+	if c.Expose.Host != "" && net.ParseIP(c.Expose.Host) == nil {
+		for _, msg := range validation.IsDNS1123Subdomain(c.Expose.Host) {
+			errList = append(errList, field.Invalid(path.Child("host"), c.Expose.Host, msg))
+		}
+	}
+	return errList
+}
+
+type subnet struct {
+	path     *field.Path
+	value    string
+	v6       bool
+	required bool
+}
+
+func (c *Cluster) validateSubnets() field.ErrorList {
+	var errList field.ErrorList
+	subnets := []subnet{
+		{path: field.NewPath("subnet"), value: c.Subnet, required: true},
+		{path: field.NewPath("podv4subnet"), value: c.Podv4subnet, required: true},
+		{path: field.NewPath("podv6subnet"), value: c.Podv6subnet, v6: true},
+		{path: field.NewPath("servicev4subnet"), value: c.Servicev4subnet, required: true},
+		{path: field.NewPath("servicev6subnet"), value: c.Servicev6subnet, v6: true},
+	}
+	for idx, network := range c.Networks {
+		subnets = append(subnets, subnet{path: field.NewPath("networks").Index(idx).Child("subnet"), value: network.Subnet, required: true})
+	}
+	var parsed []*net.IPNet
+	var parsedSubnets []subnet
+	for _, s := range subnets {
+		if s.value == "" {
+			if s.required {
+				errList = append(errList, field.Required(s.path, ""))
+			}
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(s.value)
+		if err != nil {
+			errList = append(errList, field.Invalid(s.path, s.value, "must be a valid CIDR"))
+			continue
+		}
+		if isV6 := ipnet.IP.To4() == nil; isV6 != s.v6 {
+			family := "IPv4"
+			if s.v6 {
+				family = "IPv6"
+			}
+			errList = append(errList, field.Invalid(s.path, s.value, fmt.Sprintf("must be an %s CIDR", family)))
+			continue
+		}
+		for idx, other := range parsed {
+			if ipnet.Contains(other.IP) || other.Contains(ipnet.IP) {
+				errList = append(errList, field.Invalid(s.path, s.value, fmt.Sprintf("overlaps with %s %s", parsedSubnets[idx].path, parsedSubnets[idx].value)))
+			}
+		}
+		parsed = append(parsed, ipnet)
+		parsedSubnets = append(parsedSubnets, s)
+	}
+	return errList
+}
+
+func (c *Cluster) validateNodePools() field.ErrorList {
+	var errList field.ErrorList
+	path := field.NewPath("nodePools")
+	if len(c.Pools) > 0 && (c.Controller != 0 || c.Worker != 0) {
+		errList = append(errList, field.Forbidden(path, "controller and worker must not be set together with nodePools"))
+	}
+	if c.Count(roles.Controller) < 1 {
+		errList = append(errList, field.Required(field.NewPath("controller"), "at least one controller is needed"))
+	}
+	var poolNames = make(map[string]struct{})
+	for idx, pool := range c.NodePools() {
+		poolPath := path.Index(idx)
+		if len(c.Pools) == 0 {
+			// implicit pools are reported against the cluster fields
+			poolPath = nil
+		}
+		if _, ok := poolNames[pool.Name]; ok {
+			errList = append(errList, field.Duplicate(fieldPath(poolPath, "name"), pool.Name))
+		}
+		poolNames[pool.Name] = struct{}{}
+		errList = append(errList, validateName(fieldPath(poolPath, "name"), NodeName(pool, pool.Count))...)
+		if pool.Role != roles.Controller && pool.Role != roles.Worker {
+			errList = append(errList, field.NotSupported(fieldPath(poolPath, "role"), pool.Role, []string{string(roles.Controller), string(roles.Worker)}))
+		}
+		if pool.Addressoffset != 0 && pool.Addressoffset < 2 {
+			errList = append(errList, field.Invalid(fieldPath(poolPath, "addressoffset"), pool.Addressoffset, "must be at least 2, the first addresses are network and gateway"))
+		}
+		if pool.Count < 0 {
+			errList = append(errList, field.Invalid(fieldPath(poolPath, "count"), pool.Count, "must not be negative"))
+		}
+		if pool.Count == 0 {
+			continue
+		}
+		errList = append(errList, validateQuantity(fieldPath(poolPath, "cpu"), pool.Cpu)...)
+		errList = append(errList, validateQuantity(fieldPath(poolPath, "memory"), pool.Memory)...)
+		switch pool.Disk.Mode {
+		case "", ContainerDisk:
+			if pool.Image == "" {
+				errList = append(errList, field.Required(fieldPath(poolPath, "image"), ""))
+			}
+		case DataVolume:
+			if pool.Image == "" && pool.Disk.Sourcepvc == "" {
+				errList = append(errList, field.Required(fieldPath(poolPath, "image"), "image or disk.sourcepvc is needed"))
+			}
+			if pool.Disk.Size != "" {
+				errList = append(errList, validateQuantity(fieldPath(poolPath, "disk").Child("size"), pool.Disk.Size)...)
+			}
+			if pool.Disk.Sourcepvc != "" && len(strings.Split(pool.Disk.Sourcepvc, "/")) != 2 {
+				errList = append(errList, field.Invalid(fieldPath(poolPath, "disk").Child("sourcepvc"), pool.Disk.Sourcepvc, "must be namespace/name"))
+			}
+		default:
+			errList = append(errList, field.NotSupported(fieldPath(poolPath, "disk").Child("mode"), pool.Disk.Mode, []string{string(ContainerDisk), string(DataVolume)}))
+		}
+	}
+	return errList
+}
+
+// fieldPath returns the child of a node pool path, or the top level cluster
+// field if the pool is implicit.
+func fieldPath(poolPath *field.Path, name string) *field.Path {
+	if poolPath == nil {
+		return field.NewPath(name)
+	}
+	return poolPath.Child(name)
+}
+
+func validateName(path *field.Path, name string) field.ErrorList {
+	var errList field.ErrorList
+	if name == "" {
+		return append(errList, field.Required(path, ""))
+	}
+	for _, msg := range validation.IsDNS1123Label(name) {
+		errList = append(errList, field.Invalid(path, name, msg))
+	}
+	return errList
+}
+
+func validateQuantity(path *field.Path, value string) field.ErrorList {
+	var errList field.ErrorList
+	if value == "" {
+		return append(errList, field.Required(path, ""))
+	}
+	if _, err := resource.ParseQuantity(value); err != nil {
+		errList = append(errList, field.Invalid(path, value, err.Error()))
+	}
+	return errList
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
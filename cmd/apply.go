@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	"github.com/michaelhenkel/cn2kubevirt/operator"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	applyDryRun bool
+)
+
+func init() {
+	applyCmd.PersistentFlags().StringVarP(&file, "file", "f", "", "file")
+	applyCmd.PersistentFlags().BoolVarP(&applyDryRun, "dry-run", "", false, "print the VirtualCluster instead of applying it")
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "applies a cluster file as VirtualCluster for the operator",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		if file != "" {
+			if err := applyCluster(); err != nil {
+				klog.Error(err)
+				os.Exit(1)
+			}
+		} else {
+			klog.Errorf("missing file")
+			os.Exit(1)
+		}
+	},
+}
+
+func applyCluster() error {
+	cl, err := readCluster()
+	if err != nil {
+		return err
+	}
+	vc, err := operator.NewVirtualCluster(cl)
+	if err != nil {
+		return err
+	}
+	if applyDryRun {
+		vcByte, err := yaml.Marshal(vc.Object)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(vcByte))
+		return nil
+	}
+	client, err := k8s.NewClient(kubeconfig, kubecontext)
+	if err != nil {
+		return err
+	}
+	vcByte, err := json.Marshal(vc.Object)
+	if err != nil {
+		return err
+	}
+	force := true
+	if _, err := client.Dynamic.Resource(operator.GroupVersionResource).Namespace(vc.GetNamespace()).Patch(context.Background(), vc.GetName(), types.ApplyPatchType, vcByte, metav1.PatchOptions{
+		FieldManager: "cn2kubevirt",
+		Force:        &force,
+	}); err != nil {
+		return err
+	}
+	klog.Infof("applied virtualcluster %s/%s", vc.GetNamespace(), vc.GetName())
+	return nil
+}
@@ -3,27 +3,36 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"time"
 
-	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"github.com/michaelhenkel/cn2kubevirt/artifacts"
 	"github.com/michaelhenkel/cn2kubevirt/inventory"
 	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	"github.com/michaelhenkel/cn2kubevirt/kubespray"
 	"github.com/michaelhenkel/cn2kubevirt/kubevirt"
-	"github.com/michaelhenkel/cn2kubevirt/roles"
+	"github.com/michaelhenkel/cn2kubevirt/sshprobe"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/klog"
 
-	nadv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var (
+	dryRun       bool
+	install      bool
+	deployCn2    bool
+	createOutput string
 )
 
 func init() {
 	createCmd.PersistentFlags().StringVarP(&file, "file", "f", "", "file")
+	createCmd.PersistentFlags().BoolVarP(&dryRun, "dry-run", "", false, "print the generated manifests instead of creating them")
+	createCmd.PersistentFlags().BoolVarP(&install, "install", "", false, "run kubespray in a job on the host cluster")
+	createCmd.PersistentFlags().BoolVarP(&deployCn2, "deploy-cn2", "", false, "apply deployer.yaml to the guest cluster after --install")
+	createCmd.PersistentFlags().DurationVarP(&deployTimeout, "timeout", "", 30*time.Minute, "time to wait for CN2 to become ready")
+	createCmd.PersistentFlags().StringVarP(&createOutput, "output", "o", "yaml", "dry-run output format (yaml, json)")
 }
 
 var createCmd = &cobra.Command{
@@ -31,65 +40,37 @@ var createCmd = &cobra.Command{
 	Short: "",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		if file != "" {
+		if file != "" && dryRun {
+			if err := renderCluster(); err != nil {
+				klog.Error(err)
+				os.Exit(1)
+			}
+		} else if file != "" {
 			klog.Info("creating cluster")
 			if err := createCluster(); err != nil {
 				klog.Error(err)
-				os.Exit(0)
+				os.Exit(1)
 			}
 		} else {
 			klog.Errorf("missing file")
-			os.Exit(0)
+			os.Exit(1)
 		}
 	},
 }
 
 func createCluster() error {
-	clusterByte, err := ioutil.ReadFile(file)
+	cl, err := readCluster()
 	if err != nil {
 		return err
 	}
-	cl := &cluster.Cluster{}
-	if err := yaml.Unmarshal(clusterByte, cl); err != nil {
+	if err := validateCluster(cl); err != nil {
 		return err
 	}
-	client, err := k8s.NewClient()
+	client, err := k8s.NewClient(kubeconfig, kubecontext)
 	if err != nil {
 		return err
 	}
-	_, err = client.K8S.CoreV1().Namespaces().Get(context.Background(), cl.Namespace, metav1.GetOptions{})
-	if errors.IsNotFound(err) {
-		namespace := &v1.Namespace{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: cl.Namespace,
-			},
-		}
-		_, err = client.K8S.CoreV1().Namespaces().Create(context.Background(), namespace, metav1.CreateOptions{})
-		if err != nil {
-			return err
-		}
-	} else if err != nil {
-		return err
-	}
-	_, err = client.Nad.K8sCniCncfIoV1().NetworkAttachmentDefinitions(cl.Namespace).Get(context.Background(), cl.Name, metav1.GetOptions{})
-	if errors.IsNotFound(err) {
-		nad := &nadv1.NetworkAttachmentDefinition{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      cl.Name,
-				Namespace: cl.Namespace,
-				Annotations: map[string]string{
-					"juniper.net/networks": fmt.Sprintf(`{"ipamV4Subnet": "%s","fabricSNAT": true}`, cl.Subnet),
-				},
-			},
-			Spec: nadv1.NetworkAttachmentDefinitionSpec{
-				Config: `{"cniVersion": "0.3.1","name": "contrail-k8s-cni",	"type": "contrail-k8s-cni"}`,
-			},
-		}
-		_, err = client.Nad.K8sCniCncfIoV1().NetworkAttachmentDefinitions(cl.Namespace).Create(context.Background(), nad, metav1.CreateOptions{})
-		if err != nil {
-			return err
-		}
-	} else if err != nil {
+	if err := kubevirt.CreateNetworks(client, cl); err != nil {
 		return err
 	}
 
@@ -97,53 +78,24 @@ func createCluster() error {
 	if err != nil {
 		return err
 	}
-	if err := kvc.Create(client.Kubevirt); err != nil {
+	if _, err := kvc.Create(client.Kubevirt); err != nil {
 		return err
 	}
 	instanceMap, err := kvc.Watch(client, cl)
 	if err != nil {
 		return err
 	}
-	var serviceIP string
-	watch := false
-	svc, err := client.K8S.CoreV1().Services(cl.Namespace).Get(context.Background(), cl.Name, metav1.GetOptions{})
-	if err == nil {
-		if svc.Spec.ClusterIP != "" {
-			serviceIP = svc.Spec.ClusterIP
-		} else {
-			watch = true
-		}
-	} else if errors.IsNotFound(err) {
-		service := &v1.Service{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      cl.Name,
-				Namespace: cl.Namespace,
-				Labels:    map[string]string{"cluster": cl.Name},
-			},
-			Spec: v1.ServiceSpec{
-				Ports: []v1.ServicePort{{
-					Name: "api",
-					Port: 6443,
-					TargetPort: intstr.IntOrString{
-						IntVal: 6443,
-					},
-					Protocol: v1.ProtocolTCP,
-				}},
-				Selector: map[string]string{
-					"cluster": cl.Name,
-					"role":    string(roles.Controller),
-				},
-			},
-		}
-		if _, err := client.K8S.CoreV1().Services(cl.Namespace).Create(context.Background(), service, metav1.CreateOptions{}); err != nil {
+	if !cl.Ssh.Skip {
+		if err := sshprobe.WaitForNodes(instanceMap, cl); err != nil {
 			return err
 		}
-		watch = true
-
-	} else if err != nil {
+	}
+	svc, err := kubevirt.CreateService(client, cl)
+	if err != nil {
 		return err
 	}
-	if watch {
+	serviceIP := svc.Spec.ClusterIP
+	if serviceIP == "" {
 		watch, err := client.K8S.CoreV1().Services(cl.Namespace).Watch(context.Background(), metav1.ListOptions{
 			LabelSelector: fmt.Sprintf("cluster=%s", cl.Name),
 		})
@@ -167,8 +119,35 @@ func createCluster() error {
 		}()
 		<-done
 	}
-	if err := inventory.NewInventory(instanceMap, *cl, serviceIP); err != nil {
+	externalEndpoint, err := kubevirt.WaitForExternalEndpoint(client, cl)
+	if err != nil {
+		return err
+	}
+	if err := inventory.NewInventory(instanceMap, *cl, serviceIP, externalEndpoint); err != nil {
+		return err
+	}
+	if install {
+		if err := kubespray.Install(client, cl); err != nil {
+			return err
+		}
+	}
+	if err := inventory.RewriteKubeconfig(*cl, serviceIP); err != nil {
 		return err
 	}
+	if externalEndpoint != "" {
+		if err := inventory.WriteExternalKubeconfig(*cl, externalEndpoint); err != nil {
+			return err
+		}
+	}
+	if cl.Storeartifacts {
+		if err := artifacts.Store(client, cl); err != nil {
+			return err
+		}
+	}
+	if install && deployCn2 {
+		if err := deployCN2(cl); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/michaelhenkel/cn2kubevirt/artifacts"
+	"github.com/michaelhenkel/cn2kubevirt/inventory"
+	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	"github.com/michaelhenkel/cn2kubevirt/kubespray"
+	"github.com/michaelhenkel/cn2kubevirt/kubevirt"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+var (
+	deleteNamespace bool
+)
+
+func init() {
+	deleteCmd.PersistentFlags().StringVarP(&file, "file", "f", "", "file")
+	deleteCmd.PersistentFlags().BoolVarP(&deleteNamespace, "namespace", "", false, "also delete the cluster namespace")
+}
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "deletes a cluster created by create",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		if file != "" {
+			klog.Info("deleting cluster")
+			if err := deleteCluster(); err != nil {
+				klog.Error(err)
+				os.Exit(1)
+			}
+		} else {
+			klog.Errorf("missing file")
+			os.Exit(1)
+		}
+	},
+}
+
+func deleteCluster() error {
+	cl, err := readCluster()
+	if err != nil {
+		return err
+	}
+	client, err := k8s.NewClient(kubeconfig, kubecontext)
+	if err != nil {
+		return err
+	}
+	if err := kubevirt.Delete(client, cl); err != nil {
+		return err
+	}
+	if err := kubespray.Delete(client, cl); err != nil {
+		return err
+	}
+	err = client.K8S.CoreV1().Secrets(cl.Namespace).Delete(context.Background(), kubespray.KubeconfigSecretName(cl), metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err := kubevirt.DeleteResources(client, cl); err != nil {
+		return err
+	}
+	if err := artifacts.Delete(client, cl); err != nil {
+		return err
+	}
+	if deleteNamespace {
+		err = client.K8S.CoreV1().Namespaces().Delete(context.Background(), cl.Namespace, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		klog.Infof("deleted namespace %s", cl.Namespace)
+	}
+	if cl.Kubeconfigdir != "" {
+		for _, f := range []string{"inventory.yaml", "inventory.previous.yaml", "admin.conf", inventory.ExternalKubeconfig, "deployer.yaml"} {
+			if err := os.Remove(filepath.Join(cl.Kubeconfigdir, f)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		// the directory may also hold artifacts written by kubespray,
+		// so it is only removed when nothing else is left in it.
+		if err := os.Remove(cl.Kubeconfigdir); err == nil {
+			klog.Infof("deleted %s", cl.Kubeconfigdir)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"github.com/michaelhenkel/cn2kubevirt/deployer"
+	"github.com/michaelhenkel/cn2kubevirt/inventory"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var (
+	deployTimeout time.Duration
+)
+
+func init() {
+	deployCmd.PersistentFlags().StringVarP(&file, "file", "f", "", "file")
+	deployCmd.PersistentFlags().DurationVarP(&deployTimeout, "timeout", "", 30*time.Minute, "time to wait for CN2 to become ready")
+}
+
+var deployCmd = &cobra.Command{
+	Use:   "deploy-cn2",
+	Short: "applies deployer.yaml to the guest cluster and waits for CN2, preferring the external kubeconfig",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		if file != "" {
+			cl, err := readCluster()
+			if err != nil {
+				klog.Error(err)
+				os.Exit(1)
+			}
+			klog.Info("deploying cn2")
+			if err := deployCN2(cl); err != nil {
+				klog.Error(err)
+				os.Exit(1)
+			}
+		} else {
+			klog.Errorf("missing file")
+			os.Exit(1)
+		}
+	},
+}
+
+func deployCN2(cl *cluster.Cluster) error {
+	manifest, err := os.ReadFile(filepath.Join(cl.Kubeconfigdir, "deployer.yaml"))
+	if err != nil {
+		return err
+	}
+	// admin.conf points to the service IP, which is only reachable from
+	// inside the host cluster
+	kubeconfigPath := filepath.Join(cl.Kubeconfigdir, inventory.ExternalKubeconfig)
+	if _, err := os.Stat(kubeconfigPath); os.IsNotExist(err) {
+		kubeconfigPath = filepath.Join(cl.Kubeconfigdir, "admin.conf")
+	}
+	applier, err := deployer.NewApplier(kubeconfigPath)
+	if err != nil {
+		return err
+	}
+	return applier.Apply(string(manifest), deployTimeout)
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/michaelhenkel/cn2kubevirt/artifacts"
+	"github.com/michaelhenkel/cn2kubevirt/inventory"
+	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	"github.com/michaelhenkel/cn2kubevirt/kubespray"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var (
+	getKubeconfigDir      string
+	getKubeconfigExternal bool
+)
+
+func init() {
+	getKubeconfigCmd.PersistentFlags().StringVarP(&file, "file", "f", "", "file")
+	getKubeconfigCmd.PersistentFlags().StringVarP(&getKubeconfigDir, "dir", "d", "", "write admin.conf, inventory.yaml and deployer.yaml to dir instead of printing admin.conf")
+	getKubeconfigCmd.PersistentFlags().BoolVarP(&getKubeconfigExternal, "external", "", false, "print the kubeconfig pointing to the external endpoint")
+}
+
+var getKubeconfigCmd = &cobra.Command{
+	Use:   "get-kubeconfig",
+	Short: "retrieves the kubeconfig and files stored in the cluster namespace",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		if file != "" {
+			if err := getKubeconfig(); err != nil {
+				klog.Error(err)
+				os.Exit(1)
+			}
+		} else {
+			klog.Errorf("missing file")
+			os.Exit(1)
+		}
+	},
+}
+
+func getKubeconfig() error {
+	cl, err := readCluster()
+	if err != nil {
+		return err
+	}
+	client, err := k8s.NewClient(kubeconfig, kubecontext)
+	if err != nil {
+		return err
+	}
+	files, err := artifacts.Fetch(client, cl)
+	if err != nil {
+		return err
+	}
+	if getKubeconfigDir == "" {
+		key := kubespray.KubeconfigKey
+		if getKubeconfigExternal {
+			key = inventory.ExternalKubeconfig
+		}
+		adminConf, ok := files[key]
+		if !ok {
+			return fmt.Errorf("no %s stored for cluster %s/%s", key, cl.Namespace, cl.Name)
+		}
+		_, err := os.Stdout.Write(adminConf)
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files stored for cluster %s/%s", cl.Namespace, cl.Name)
+	}
+	if err := os.MkdirAll(getKubeconfigDir, 0755); err != nil {
+		return err
+	}
+	for name, content := range files {
+		path := filepath.Join(getKubeconfigDir, name)
+		if err := os.WriteFile(path, content, 0600); err != nil {
+			return err
+		}
+		klog.Infof("wrote %s", path)
+	}
+	return nil
+}
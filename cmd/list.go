@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	"github.com/michaelhenkel/cn2kubevirt/kubevirt"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/klog"
+)
+
+var (
+	listOutput string
+)
+
+func init() {
+	listCmd.PersistentFlags().StringVarP(&listOutput, "output", "o", "table", "output format (table, json, yaml)")
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "lists all clusters on the host cluster",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := listClusters(); err != nil {
+			klog.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func listClusters() error {
+	client, err := k8s.NewClient(kubeconfig, kubecontext)
+	if err != nil {
+		return err
+	}
+	clusterList, err := kubevirt.List(client)
+	if err != nil {
+		return err
+	}
+	return printObject(listOutput, clusterList, func(w io.Writer) {
+		fmt.Fprintln(w, "NAMESPACE\tNAME\tCONTROLLER\tWORKER\tREADY\tCPU\tMEMORY\tSERVICE IP\tAGE")
+		for _, cl := range clusterList {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d/%d\t%s\t%s\t%s\t%s\n", cl.Namespace, cl.Name, cl.Controller, cl.Worker,
+				cl.Ready, cl.Controller+cl.Worker, cl.Cpu, cl.Memory, cl.ServiceIP, duration.HumanDuration(time.Since(cl.Created.Time)))
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	"github.com/michaelhenkel/cn2kubevirt/operator"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var (
+	workdir  string
+	interval time.Duration
+)
+
+func init() {
+	operatorCmd.PersistentFlags().StringVarP(&workdir, "workdir", "", "/var/lib/cn2kubevirt", "directory for the inventory files of the clusters")
+	operatorCmd.PersistentFlags().DurationVarP(&interval, "interval", "", 30*time.Second, "reconcile interval")
+}
+
+var operatorCmd = &cobra.Command{
+	Use:   "operator",
+	Short: "reconciles VirtualCluster resources",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runOperator(); err != nil {
+			klog.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func runOperator() error {
+	client, err := k8s.NewClient(kubeconfig, kubecontext)
+	if err != nil {
+		return err
+	}
+	if err := operator.InstallCustomResourceDefinition(client); err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		klog.Info("stopping operator")
+		close(stop)
+	}()
+	klog.Infof("reconciling virtual clusters every %s", interval)
+	operator.NewController(client, workdir, interval).Run(stop)
+	return nil
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// printObject writes obj to stdout in the given output format. table is
+// called for the default table format.
+func printObject(format string, obj interface{}, table func(w io.Writer)) error {
+	switch format {
+	case "", "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		table(w)
+		return w.Flush()
+	case "json":
+		objByte, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(objByte))
+	case "yaml":
+		objByte, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(objByte))
+	default:
+		return fmt.Errorf("unknown output format %s", format)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"github.com/michaelhenkel/cn2kubevirt/deployer"
+	"github.com/michaelhenkel/cn2kubevirt/kubevirt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// renderCluster prints all manifests create would apply, followed by the
+// deployer manifest, without contacting the cluster.
+func renderCluster() error {
+	cl, err := readCluster()
+	if err != nil {
+		return err
+	}
+	if err := validateCluster(cl); err != nil {
+		return err
+	}
+	kvc, err := kubevirt.NewKubevirtCluster(cl)
+	if err != nil {
+		return err
+	}
+	var objects []interface{}
+	objects = append(objects, kubevirt.DefineNamespace(cl))
+	nads, err := kubevirt.DefineNetworkAttachmentDefinitions(cl)
+	if err != nil {
+		return err
+	}
+	for _, nad := range nads {
+		objects = append(objects, nad)
+	}
+	for _, dv := range kvc.DataVolumes {
+		objects = append(objects, dv)
+	}
+	if len(kvc.VirtualMachines) > 0 {
+		for _, vm := range kvc.VirtualMachines {
+			objects = append(objects, vm)
+		}
+	} else {
+		for _, vmi := range kvc.VirtualMachineInstances {
+			objects = append(objects, vmi)
+		}
+	}
+	objects = append(objects, kubevirt.DefineService(cl))
+	switch cl.Expose.Type {
+	case cluster.ExposeIngress:
+		objects = append(objects, kubevirt.DefineIngress(cl))
+	case cluster.ExposeRoute:
+		objects = append(objects, kubevirt.DefineRoute(cl))
+	}
+	d, err := deployer.NewClusterDeployer(*cl)
+	if err != nil {
+		return err
+	}
+	deployerObjects, err := d.Objects()
+	if err != nil {
+		return err
+	}
+	objects = append(objects, deployerObjects...)
+	var docs [][]byte
+	for _, obj := range objects {
+		objByte, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, objByte)
+	}
+	switch createOutput {
+	case "", "yaml":
+		for idx, doc := range docs {
+			docByte, err := yaml.JSONToYAML(doc)
+			if err != nil {
+				return err
+			}
+			if idx > 0 {
+				fmt.Println("---")
+			}
+			fmt.Print(string(docByte))
+		}
+	case "json":
+		list := metav1.List{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "v1",
+				Kind:       "List",
+			},
+		}
+		for _, doc := range docs {
+			list.Items = append(list.Items, runtime.RawExtension{Raw: doc})
+		}
+		listByte, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(listByte))
+	default:
+		return fmt.Errorf("unknown output format %s", createOutput)
+	}
+	return nil
+}
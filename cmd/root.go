@@ -2,18 +2,34 @@ package cmd
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 var (
-	file string
+	file        string
+	kubeconfig  string
+	kubecontext string
 )
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	rootCmd.PersistentFlags().StringVarP(&kubeconfig, "kubeconfig", "", "", "kubeconfig of the host cluster, defaults to KUBECONFIG, ~/.kube/config or the in-cluster config")
+	rootCmd.PersistentFlags().StringVarP(&kubecontext, "context", "", "", "kubeconfig context of the host cluster")
 	rootCmd.AddCommand(createCmd)
+	rootCmd.AddCommand(deleteCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(scaleCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(deployCmd)
+	rootCmd.AddCommand(operatorCmd)
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(getKubeconfigCmd)
 }
 
 func initConfig() {
@@ -28,6 +44,18 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+func readCluster() (*cluster.Cluster, error) {
+	clusterByte, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	cl := &cluster.Cluster{}
+	if err := yaml.Unmarshal(clusterByte, cl); err != nil {
+		return nil, err
+	}
+	return cl, nil
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/michaelhenkel/cn2kubevirt/artifacts"
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"github.com/michaelhenkel/cn2kubevirt/inventory"
+	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	"github.com/michaelhenkel/cn2kubevirt/kubevirt"
+	"github.com/michaelhenkel/cn2kubevirt/roles"
+	"github.com/michaelhenkel/cn2kubevirt/sshprobe"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+var (
+	worker int
+	pool   string
+)
+
+func init() {
+	scaleCmd.PersistentFlags().StringVarP(&file, "file", "f", "", "file")
+	scaleCmd.PersistentFlags().IntVarP(&worker, "worker", "w", 0, "number of workers, defaults to the worker count in file")
+	scaleCmd.PersistentFlags().StringVarP(&pool, "pool", "p", "", "node pool to scale, defaults to the first worker pool")
+}
+
+var scaleCmd = &cobra.Command{
+	Use:   "scale",
+	Short: "adds or removes workers of an existing cluster",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		if file != "" {
+			klog.Info("scaling cluster")
+			if err := scaleCluster(cmd.Flags().Changed("worker")); err != nil {
+				klog.Error(err)
+				os.Exit(1)
+			}
+		} else {
+			klog.Errorf("missing file")
+			os.Exit(1)
+		}
+	},
+}
+
+func scaleCluster(workerChanged bool) error {
+	cl, err := readCluster()
+	if err != nil {
+		return err
+	}
+	if workerChanged {
+		if err := setWorkerCount(cl, pool, worker); err != nil {
+			return err
+		}
+	}
+	if err := validateCluster(cl); err != nil {
+		return err
+	}
+	client, err := k8s.NewClient(kubeconfig, kubecontext)
+	if err != nil {
+		return err
+	}
+	svc, err := client.K8S.CoreV1().Services(cl.Namespace).Get(context.Background(), cl.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	kvc, err := kubevirt.NewKubevirtCluster(cl)
+	if err != nil {
+		return err
+	}
+	removed, err := kvc.Prune(client, cl)
+	if err != nil {
+		return err
+	}
+	added, err := kvc.Create(client.Kubevirt)
+	if err != nil {
+		return err
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		klog.Infof("cluster already has %d workers", cl.Count(roles.Worker))
+		return nil
+	}
+	instanceMap, err := kvc.Watch(client, cl)
+	if err != nil {
+		return err
+	}
+	if !cl.Ssh.Skip {
+		if err := sshprobe.WaitForNodes(instanceMap, cl); err != nil {
+			return err
+		}
+	}
+	// remove-node.yml needs the removed nodes in its inventory, so the
+	// previous inventory is kept next to the new one.
+	inventoryPath := filepath.Join(cl.Kubeconfigdir, "inventory.yaml")
+	previousInventoryPath := filepath.Join(cl.Kubeconfigdir, "inventory.previous.yaml")
+	if _, err := os.Stat(inventoryPath); err == nil {
+		if err := os.Rename(inventoryPath, previousInventoryPath); err != nil {
+			return err
+		}
+	}
+	externalEndpoint, err := kubevirt.ExternalEndpoint(client, cl, svc)
+	if err != nil {
+		return err
+	}
+	if err := inventory.NewInventory(instanceMap, *cl, svc.Spec.ClusterIP, externalEndpoint); err != nil {
+		return err
+	}
+	if err := inventory.RewriteKubeconfig(*cl, svc.Spec.ClusterIP); err != nil {
+		return err
+	}
+	if externalEndpoint != "" {
+		if err := inventory.WriteExternalKubeconfig(*cl, externalEndpoint); err != nil {
+			return err
+		}
+	}
+	if cl.Storeartifacts {
+		if err := artifacts.Store(client, cl); err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 {
+		klog.Infof("added %s, run: ansible-playbook -i %s scale.yml --limit=%s", strings.Join(added, ","), inventoryPath, strings.Join(added, ","))
+	}
+	if len(removed) > 0 {
+		klog.Infof("removed %s, run: ansible-playbook -i %s remove-node.yml -e node=%s -e reset_nodes=false -e allow_ungraceful_removal=true",
+			strings.Join(removed, ","), previousInventoryPath, strings.Join(removed, ","))
+	}
+	return nil
+}
+
+// setWorkerCount sets the node count of the named worker pool, or of the
+// first worker pool if name is empty.
+func setWorkerCount(cl *cluster.Cluster, name string, count int) error {
+	if len(cl.Pools) == 0 {
+		if name != "" && name != string(roles.Worker) {
+			return fmt.Errorf("node pool %s not found", name)
+		}
+		cl.Worker = count
+		return nil
+	}
+	for idx, nodePool := range cl.Pools {
+		if nodePool.Role != roles.Worker {
+			continue
+		}
+		poolName := nodePool.Name
+		if poolName == "" {
+			poolName = string(nodePool.Role)
+		}
+		if name == "" || name == poolName {
+			cl.Pools[idx].Count = count
+			return nil
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("no worker node pool found")
+	}
+	return fmt.Errorf("worker node pool %s not found", name)
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	"github.com/michaelhenkel/cn2kubevirt/kubevirt"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+var (
+	statusOutput string
+)
+
+func init() {
+	statusCmd.PersistentFlags().StringVarP(&file, "file", "f", "", "file")
+	statusCmd.PersistentFlags().StringVarP(&statusOutput, "output", "o", "table", "output format (table, json, yaml)")
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "shows the per node status of a cluster",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		if file != "" {
+			if err := clusterStatus(); err != nil {
+				klog.Error(err)
+				os.Exit(1)
+			}
+		} else {
+			klog.Errorf("missing file")
+			os.Exit(1)
+		}
+	},
+}
+
+func clusterStatus() error {
+	cl, err := readCluster()
+	if err != nil {
+		return err
+	}
+	client, err := k8s.NewClient(kubeconfig, kubecontext)
+	if err != nil {
+		return err
+	}
+	kvc, err := kubevirt.NewKubevirtCluster(cl)
+	if err != nil {
+		return err
+	}
+	status, err := kvc.Status(client, cl)
+	if err != nil {
+		return err
+	}
+	return printObject(statusOutput, status, func(w io.Writer) {
+		fmt.Fprintf(w, "cluster %s/%s, service ip %s\n\n", status.Namespace, status.Name, status.ServiceIP)
+		fmt.Fprintln(w, "NAME\tROLE\tPHASE\tPOD\tNODE\tPOD IP\tCLUSTER IP")
+		for _, node := range status.Nodes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", node.Name, node.Role, node.Phase, node.Pod, node.Node, node.PodIP, node.ClusterIP)
+		}
+	})
+}
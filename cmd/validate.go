@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"github.com/michaelhenkel/cn2kubevirt/deployer"
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+func init() {
+	validateCmd.PersistentFlags().StringVarP(&file, "file", "f", "", "file")
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "validates a cluster file",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		if file != "" {
+			cl, err := readCluster()
+			if err != nil {
+				klog.Error(err)
+				os.Exit(1)
+			}
+			if err := validateCluster(cl); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Printf("cluster %s is valid\n", cl.Name)
+		} else {
+			klog.Errorf("missing file")
+			os.Exit(1)
+		}
+	},
+}
+
+// validateCluster validates the cluster spec and the deployer config derived
+// from it.
+func validateCluster(cl *cluster.Cluster) error {
+	if err := cl.Validate(); err != nil {
+		return err
+	}
+	_, err := deployer.NewClusterDeployer(*cl)
+	return err
+}
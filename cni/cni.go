@@ -0,0 +1,127 @@
+package cni
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+
+	nadv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const cniVersion = "0.3.1"
+
+// Provider defines the NetworkAttachmentDefinitions the nodes are attached
+// to on the host cluster.
+type Provider interface {
+	NetworkAttachmentDefinition(network Network) (*nadv1.NetworkAttachmentDefinition, error)
+}
+
+// Network is the network a NetworkAttachmentDefinition is defined for.
+type Network struct {
+	Namespace string
+	Name      string
+	Subnet    string
+	// Address is the static address in CIDR notation of the node the
+	// NetworkAttachmentDefinition is defined for. KubeVirt doesn't pass
+	// address requests of the VMI to the CNI, so every node with a static
+	// address gets its own NetworkAttachmentDefinition.
+	Address string
+	// Addresses are the static addresses of the nodes in CIDR notation,
+	// which the IPAM of a shared NetworkAttachmentDefinition leaves out.
+	Addresses map[string]string
+}
+
+// NewProvider returns the provider selected in config.
+func NewProvider(config cluster.Cni) (Provider, error) {
+	switch config.Provider {
+	case "", cluster.CN2:
+		return &cn2{}, nil
+	case cluster.Bridge:
+		return &bridge{config: config}, nil
+	case cluster.Macvlan:
+		return &macvlan{config: config}, nil
+	case cluster.OVNKubernetes:
+		return &ovnKubernetes{}, nil
+	}
+	return nil, fmt.Errorf("unknown cni provider %s", config.Provider)
+}
+
+func defineNetworkAttachmentDefinition(namespace, name string, annotations map[string]string, config map[string]interface{}) (*nadv1.NetworkAttachmentDefinition, error) {
+	config["cniVersion"] = cniVersion
+	if _, ok := config["name"]; !ok {
+		config["name"] = name
+	}
+	configByte, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return &nadv1.NetworkAttachmentDefinition{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: nadv1.SchemeGroupVersion.String(),
+			Kind:       "NetworkAttachmentDefinition",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Annotations: annotations,
+		},
+		Spec: nadv1.NetworkAttachmentDefinitionSpec{
+			Config: string(configByte),
+		},
+	}, nil
+}
+
+// capabilities enables the MAC address KubeVirt requests for the
+// interface of the VMI.
+func capabilities(config map[string]interface{}) map[string]interface{} {
+	config["capabilities"] = map[string]bool{
+		"mac": true,
+	}
+	return config
+}
+
+// ipam returns the IPAM config of the bridge and macvlan providers. The
+// static IPAM assigns the address of a node, otherwise whereabouts leaves
+// out the static addresses.
+func ipam(config cluster.Cni, network Network) (map[string]interface{}, error) {
+	if network.Address != "" {
+		return map[string]interface{}{
+			"type": "static",
+			"addresses": []map[string]string{{
+				"address": network.Address,
+			}},
+		}, nil
+	}
+	if config.Ipam == cluster.HostLocal {
+		return map[string]interface{}{
+			"type": string(cluster.HostLocal),
+			"ranges": [][]map[string]string{{{
+				"subnet": network.Subnet,
+			}}},
+		}, nil
+	}
+	whereabouts := map[string]interface{}{
+		"type":  string(cluster.Whereabouts),
+		"range": network.Subnet,
+	}
+	var exclude []string
+	for _, address := range network.Addresses {
+		ip, _, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, err
+		}
+		if ip.To4() != nil {
+			exclude = append(exclude, ip.String()+"/32")
+		} else {
+			exclude = append(exclude, ip.String()+"/128")
+		}
+	}
+	if len(exclude) > 0 {
+		sort.Strings(exclude)
+		whereabouts["exclude"] = exclude
+	}
+	return whereabouts, nil
+}
@@ -0,0 +1,81 @@
+package cni
+
+import (
+	"fmt"
+
+	nadv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+)
+
+// cn2 creates a CN2 virtual network per NetworkAttachmentDefinition.
+type cn2 struct{}
+
+func (p *cn2) NetworkAttachmentDefinition(network Network) (*nadv1.NetworkAttachmentDefinition, error) {
+	if network.Address != "" {
+		return nil, fmt.Errorf("cn2 doesn't support static addresses")
+	}
+	return defineNetworkAttachmentDefinition(network.Namespace, network.Name, map[string]string{
+		"juniper.net/networks": fmt.Sprintf(`{"ipamV4Subnet": "%s","fabricSNAT": true}`, network.Subnet),
+	}, map[string]interface{}{
+		"name": "contrail-k8s-cni",
+		"type": "contrail-k8s-cni",
+	})
+}
+
+type bridge struct {
+	config cluster.Cni
+}
+
+func (p *bridge) NetworkAttachmentDefinition(network Network) (*nadv1.NetworkAttachmentDefinition, error) {
+	ipamConfig, err := ipam(p.config, network)
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]interface{}{
+		"type":   "bridge",
+		"bridge": p.config.Bridge,
+		"ipam":   ipamConfig,
+	}
+	if p.config.Vlan != 0 {
+		config["vlan"] = p.config.Vlan
+	}
+	return defineNetworkAttachmentDefinition(network.Namespace, network.Name, nil, capabilities(config))
+}
+
+type macvlan struct {
+	config cluster.Cni
+}
+
+func (p *macvlan) NetworkAttachmentDefinition(network Network) (*nadv1.NetworkAttachmentDefinition, error) {
+	mode := p.config.Mode
+	if mode == "" {
+		mode = "bridge"
+	}
+	ipamConfig, err := ipam(p.config, network)
+	if err != nil {
+		return nil, err
+	}
+	return defineNetworkAttachmentDefinition(network.Namespace, network.Name, nil, capabilities(map[string]interface{}{
+		"type":   "macvlan",
+		"master": p.config.Master,
+		"mode":   mode,
+		"ipam":   ipamConfig,
+	}))
+}
+
+// ovnKubernetes defines layer2 secondary networks, the subnet is managed by
+// OVN-Kubernetes.
+type ovnKubernetes struct{}
+
+func (p *ovnKubernetes) NetworkAttachmentDefinition(network Network) (*nadv1.NetworkAttachmentDefinition, error) {
+	if network.Address != "" {
+		return nil, fmt.Errorf("ovn-k8s doesn't support static addresses")
+	}
+	return defineNetworkAttachmentDefinition(network.Namespace, network.Name, nil, map[string]interface{}{
+		"name":             fmt.Sprintf("%s.%s", network.Namespace, network.Name),
+		"type":             "ovn-k8s-cni-overlay",
+		"topology":         "layer2",
+		"subnets":          network.Subnet,
+		"netAttachDefName": fmt.Sprintf("%s/%s", network.Namespace, network.Name),
+	})
+}
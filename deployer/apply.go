@@ -0,0 +1,229 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog"
+)
+
+const (
+	fieldManager    = "cn2kubevirt"
+	applyJobName    = "apply-contrail"
+	crConfigMapName = "contrail-cr"
+	crConfigMapKey  = "contrail-cr.yaml"
+	pollInterval    = 5 * time.Second
+)
+
+// Applier applies the deployer manifest to the guest cluster.
+type Applier struct {
+	dynamic dynamic.Interface
+	mapper  *restmapper.DeferredDiscoveryRESTMapper
+}
+
+// NewApplier creates an Applier for the guest cluster described by the
+// kubeconfig file.
+func NewApplier(kubeconfig string) (*Applier, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Applier{
+		dynamic: dynamicClient,
+		mapper:  restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery())),
+	}, nil
+}
+
+// Apply server-side applies every document of the manifest and waits until
+// the apply-contrail Job finished and the CN2 custom resources it creates
+// are ready.
+func (a *Applier) Apply(manifest string, timeout time.Duration) error {
+	objects, err := decode(manifest)
+	if err != nil {
+		return err
+	}
+	var crs []*unstructured.Unstructured
+	for _, obj := range objects {
+		if err := a.apply(obj); err != nil {
+			return fmt.Errorf("%s %s: %s", obj.GetKind(), obj.GetName(), err)
+		}
+		klog.Infof("applied %s %s", obj.GetKind(), obj.GetName())
+		if obj.GetKind() == "ConfigMap" && obj.GetName() == crConfigMapName {
+			crManifest, _, err := unstructured.NestedString(obj.Object, "data", crConfigMapKey)
+			if err != nil {
+				return err
+			}
+			if crs, err = decode(crManifest); err != nil {
+				return err
+			}
+		}
+	}
+	deadline := time.Now().Add(timeout)
+	if err := a.waitForApplyJob(deadline); err != nil {
+		return err
+	}
+	return a.waitForResources(crs, deadline)
+}
+
+func (a *Applier) apply(obj *unstructured.Unstructured) error {
+	resource, err := a.resource(obj.GroupVersionKind(), obj.GetNamespace())
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	force := true
+	_, err = resource.Patch(context.Background(), obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager: fieldManager,
+		Force:        &force,
+	})
+	return err
+}
+
+// resource maps gvk to its resource client. Custom resources are only known
+// once their CRD is loaded, so the discovery cache is reset on a miss.
+func (a *Applier) resource(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, error) {
+	mapping, err := a.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		a.mapper.Reset()
+		mapping, err = a.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return a.dynamic.Resource(mapping.Resource).Namespace(namespace), nil
+	}
+	return a.dynamic.Resource(mapping.Resource), nil
+}
+
+// waitForApplyJob waits for the apply-contrail Job to succeed. The Job
+// deletes itself when done, so it being gone counts as success as well.
+func (a *Applier) waitForApplyJob(deadline time.Time) error {
+	jobGVK := schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}
+	err := wait.PollImmediate(pollInterval, time.Until(deadline), func() (bool, error) {
+		resource, err := a.resource(jobGVK, "contrail")
+		if err != nil {
+			return false, err
+		}
+		job, err := resource.Get(context.Background(), applyJobName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+		failed, _, _ := unstructured.NestedInt64(job.Object, "status", "failed")
+		if backoffLimit, ok, _ := unstructured.NestedInt64(job.Object, "spec", "backoffLimit"); ok && failed > backoffLimit {
+			return false, fmt.Errorf("job %s failed", applyJobName)
+		}
+		succeeded, _, _ := unstructured.NestedInt64(job.Object, "status", "succeeded")
+		return succeeded > 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("job %s not finished in time", applyJobName)
+	} else if err != nil {
+		return err
+	}
+	klog.Infof("job %s finished", applyJobName)
+	return nil
+}
+
+func (a *Applier) waitForResources(crs []*unstructured.Unstructured, deadline time.Time) error {
+	var pending = make(map[string]*unstructured.Unstructured)
+	for _, cr := range crs {
+		pending[fmt.Sprintf("%s %s/%s", cr.GetKind(), cr.GetNamespace(), cr.GetName())] = cr
+	}
+	err := wait.PollImmediate(pollInterval, time.Until(deadline), func() (bool, error) {
+		for key, cr := range pending {
+			resource, err := a.resource(cr.GroupVersionKind(), cr.GetNamespace())
+			if meta.IsNoMatchError(err) {
+				continue
+			} else if err != nil {
+				return false, err
+			}
+			current, err := resource.Get(context.Background(), cr.GetName(), metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return false, err
+			}
+			if ready(current) {
+				klog.Infof("%s is ready", key)
+				delete(pending, key)
+			}
+		}
+		return len(pending) == 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		var notReady []string
+		for key := range pending {
+			notReady = append(notReady, key)
+		}
+		sort.Strings(notReady)
+		return fmt.Errorf("resources not ready in time: %s", strings.Join(notReady, ", "))
+	}
+	return err
+}
+
+// ready reports whether a CN2 custom resource is ready, either by its
+// status.active flag or a Ready condition.
+func ready(obj *unstructured.Unstructured) bool {
+	if active, ok, _ := unstructured.NestedBool(obj.Object, "status", "active"); ok {
+		return active
+	}
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, condition := range conditions {
+		c, ok := condition.(map[string]interface{})
+		if ok && c["type"] == "Ready" {
+			return c["status"] == "True"
+		}
+	}
+	return false
+}
+
+func decode(manifest string) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewBufferString(manifest), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
@@ -0,0 +1,147 @@
+package deployer
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func container(config Config, name, imageName string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":  name,
+		"image": config.image(imageName),
+	}
+}
+
+// common returns the common spec shared by all CN2 custom resources.
+func common(config Config, fields map[string]interface{}) map[string]interface{} {
+	if len(config.PullSecrets) > 0 {
+		var secrets []interface{}
+		for _, secret := range config.PullSecrets {
+			secrets = append(secrets, secret)
+		}
+		fields["imagePullSecrets"] = secrets
+	}
+	return fields
+}
+
+func customResource(apiVersion, kind, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": contrailNamespace,
+			},
+			"spec": spec,
+		},
+	}
+}
+
+func masterNodeSelectorValue() map[string]interface{} {
+	return map[string]interface{}{masterLabel: ""}
+}
+
+func vrouterAgent(config Config) map[string]interface{} {
+	return map[string]interface{}{
+		"virtualHostInterface": map[string]interface{}{
+			"gateway": config.Gateway,
+		},
+	}
+}
+
+func vrouterContainers(config Config) []interface{} {
+	return []interface{}{
+		container(config, "contrail-vrouter-agent", "contrail-vrouter-agent"),
+		container(config, "contrail-watcher", "contrail-init"),
+		container(config, "contrail-vrouter-telemetry-exporter", "contrail-telemetry-exporter"),
+	}
+}
+
+func vrouterInitContainers(config Config) []interface{} {
+	return []interface{}{
+		container(config, "contrail-init", "contrail-init"),
+		container(config, "contrail-cni-init", "contrail-cni-init"),
+	}
+}
+
+// defineCustomResources defines the CN2 custom resources. Integers are
+// int64 as the unstructured helpers expect.
+func defineCustomResources(config Config) []*unstructured.Unstructured {
+	replicas := int64(config.Replicas)
+	kubemanagerSpec := map[string]interface{}{
+		"podV4Subnet":      config.Podv4subnet,
+		"serviceV4Subnet":  config.Servicev4subnet,
+		"autonomousSystem": int64(config.Asn),
+		"common": common(config, map[string]interface{}{
+			"replicas":     replicas,
+			"containers":   []interface{}{container(config, "contrail-k8s-kubemanager", "contrail-k8s-kubemanager")},
+			"nodeSelector": masterNodeSelectorValue(),
+		}),
+	}
+	if config.Podv6subnet != "" {
+		kubemanagerSpec["podV6Subnet"] = config.Podv6subnet
+	}
+	if config.Servicev6subnet != "" {
+		kubemanagerSpec["serviceV6Subnet"] = config.Servicev6subnet
+	}
+	return []*unstructured.Unstructured{
+		customResource("configplane.juniper.net/v1alpha1", "ApiServer", "contrail-k8s-apiserver", map[string]interface{}{
+			"common": common(config, map[string]interface{}{
+				"replicas":     replicas,
+				"containers":   []interface{}{container(config, "contrail-k8s-apiserver", "contrail-k8s-apiserver")},
+				"nodeSelector": masterNodeSelectorValue(),
+			}),
+		}),
+		customResource("configplane.juniper.net/v1alpha1", "Controller", "contrail-k8s-controller", map[string]interface{}{
+			"common": common(config, map[string]interface{}{
+				"replicas":     replicas,
+				"containers":   []interface{}{container(config, "contrail-k8s-controller", "contrail-k8s-controller")},
+				"nodeSelector": masterNodeSelectorValue(),
+			}),
+		}),
+		customResource("configplane.juniper.net/v1alpha1", "Kubemanager", "contrail-k8s-kubemanager", kubemanagerSpec),
+		customResource("controlplane.juniper.net/v1alpha1", "Control", "contrail-control", map[string]interface{}{
+			"common": common(config, map[string]interface{}{
+				"replicas": replicas,
+				"containers": []interface{}{
+					container(config, "contrail-control", "contrail-control"),
+					container(config, "contrail-control-telemetry-exporter", "contrail-telemetry-exporter"),
+				},
+				"initContainers": []interface{}{container(config, "contrail-init", "contrail-init")},
+				"nodeSelector":   masterNodeSelectorValue(),
+			}),
+		}),
+		customResource("dataplane.juniper.net/v1alpha1", "Vrouter", "contrail-vrouter-masters", map[string]interface{}{
+			"agent": vrouterAgent(config),
+			"common": common(config, map[string]interface{}{
+				"containers":     vrouterContainers(config),
+				"initContainers": vrouterInitContainers(config),
+				"nodeSelector":   masterNodeSelectorValue(),
+			}),
+		}),
+		customResource("dataplane.juniper.net/v1alpha1", "Vrouter", "contrail-vrouter-nodes", map[string]interface{}{
+			"agent": vrouterAgent(config),
+			"common": common(config, map[string]interface{}{
+				"affinity": map[string]interface{}{
+					"nodeAffinity": map[string]interface{}{
+						"requiredDuringSchedulingIgnoredDuringExecution": map[string]interface{}{
+							"nodeSelectorTerms": []interface{}{
+								map[string]interface{}{
+									"matchExpressions": []interface{}{
+										map[string]interface{}{
+											"key":      masterLabel,
+											"operator": "NotIn",
+											"values":   []interface{}{""},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+				"containers":     vrouterContainers(config),
+				"initContainers": vrouterInitContainers(config),
+			}),
+		}),
+	}
+}
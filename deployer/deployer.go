@@ -1,294 +1,256 @@
 package deployer
 
 import (
-	"strconv"
+	"fmt"
+	"net"
 	"strings"
+
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"github.com/michaelhenkel/cn2kubevirt/roles"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	contrailNamespace       = "contrail"
+	contrailDeployNamespace = "contrail-deploy"
+	defaultRegistry         = "svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev"
+	defaultTag              = "latest"
+	masterLabel             = "node-role.kubernetes.io/master"
 )
 
-var deployerTemplate = `apiVersion: v1
-kind: Namespace
-metadata:
-  name: contrail
----
-apiVersion: v1
-kind: Namespace
-metadata:
-  name: contrail-deploy
----
-apiVersion: v1
-kind: ServiceAccount
-metadata:
-  name: contrail-serviceaccount
-  namespace: contrail
----
-apiVersion: v1
-kind: ServiceAccount
-metadata:
-  name: contrail-deploy-serviceaccount
-  namespace: contrail-deploy
----
-apiVersion: rbac.authorization.k8s.io/v1
-kind: ClusterRole
-metadata:
-  name: contrail-role
-rules:
-- apiGroups:
-  - '*'
-  resources:
-  - '*'
-  verbs:
-  - '*'
----
-apiVersion: rbac.authorization.k8s.io/v1
-kind: ClusterRole
-metadata:
-  name: contrail-deploy-role
-rules:
-- apiGroups:
-  - '*'
-  resources:
-  - '*'
-  verbs:
-  - '*'
----
-apiVersion: rbac.authorization.k8s.io/v1
-kind: ClusterRoleBinding
-metadata:
-  name: contrail-rolebinding
-roleRef:
-  apiGroup: rbac.authorization.k8s.io
-  kind: ClusterRole
-  name: contrail-role
-subjects:
-- kind: ServiceAccount
-  name: contrail-serviceaccount
-  namespace: contrail
----
-apiVersion: rbac.authorization.k8s.io/v1
-kind: ClusterRoleBinding
-metadata:
-  name: contrail-deploy-rolebinding
-roleRef:
-  apiGroup: rbac.authorization.k8s.io
-  kind: ClusterRole
-  name: contrail-deploy-role
-subjects:
-- kind: ServiceAccount
-  name: contrail-deploy-serviceaccount
-  namespace: contrail-deploy
----
-apiVersion: apps/v1
-kind: Deployment
-metadata:
-  name: contrail-k8s-deployer
-  namespace: contrail-deploy
-spec:
-  replicas: 1
-  selector:
-    matchLabels:
-      app: contrail-k8s-deployer
-  template:
-    metadata:
-      labels:
-        app: contrail-k8s-deployer
-    spec:
-      containers:
-      - command:
-        - sh
-        - -c
-        - /manager --metrics-addr 127.0.0.1:8081
-        image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-k8s-deployer:latest
-        imagePullPolicy: Always
-        name: contrail-k8s-deployer
-      hostNetwork: true
-      initContainers:
-      - command:
-        - sh
-        - -c
-        - kustomize build /crd | kubectl apply -f -
-        image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-k8s-crdloader:latest
-        imagePullPolicy: Always
-        name: contrail-k8s-crdloader
-      nodeSelector:
-        node-role.kubernetes.io/master: ""
-      serviceAccountName: contrail-deploy-serviceaccount
-      tolerations:
-      - effect: NoSchedule
-        operator: Exists
-      - effect: NoExecute
-        operator: Exists
----
-apiVersion: v1
-data:
-  contrail-cr.yaml: |
-    apiVersion: configplane.juniper.net/v1alpha1
-    kind: ApiServer
-    metadata:
-      name: contrail-k8s-apiserver
-      namespace: contrail
-    spec:
-      common:
-        replicas: REPLICAS
-        containers:
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-k8s-apiserver:latest
-          name: contrail-k8s-apiserver
-        nodeSelector:
-          node-role.kubernetes.io/master: ""
-    ---
-    apiVersion: configplane.juniper.net/v1alpha1
-    kind: Controller
-    metadata:
-      name: contrail-k8s-controller
-      namespace: contrail
-    spec:
-      common:
-        replicas: REPLICAS
-        containers:
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-k8s-controller:latest
-          name: contrail-k8s-controller
-        nodeSelector:
-          node-role.kubernetes.io/master: ""
-    ---
-    apiVersion: configplane.juniper.net/v1alpha1
-    kind: Kubemanager
-    metadata:
-      name: contrail-k8s-kubemanager
-      namespace: contrail
-    spec:
-      podV4Subnet: PODV4SUBNET
-      podV6Subnet: PODV6SUBNET
-      serviceV4Subnet: SERVICEV4SUBNET
-      serviceV6Subnet: SERVICEV6SUBNET
-      autonomousSystem: ASN
-      common:
-        replicas: REPLICAS
-        containers:
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-k8s-kubemanager:latest
-          name: contrail-k8s-kubemanager
-        nodeSelector:
-          node-role.kubernetes.io/master: ""
-    ---
-    apiVersion: controlplane.juniper.net/v1alpha1
-    kind: Control
-    metadata:
-      name: contrail-control
-      namespace: contrail
-    spec:
-      common:
-        replicas: REPLICAS
-        containers:
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-control:latest
-          name: contrail-control
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-telemetry-exporter:latest
-          name: contrail-control-telemetry-exporter
-        initContainers:
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-init:latest
-          name: contrail-init
-        nodeSelector:
-          node-role.kubernetes.io/master: ""
-    ---
-    apiVersion: dataplane.juniper.net/v1alpha1
-    kind: Vrouter
-    metadata:
-      name: contrail-vrouter-masters
-      namespace: contrail
-    spec:
-      agent:
-        virtualHostInterface:
-          gateway: GATEWAY
-      common:
-        containers:
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-vrouter-agent:latest
-          name: contrail-vrouter-agent
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-init:latest
-          name: contrail-watcher
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-telemetry-exporter:latest
-          name: contrail-vrouter-telemetry-exporter
-        initContainers:
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-init:latest
-          name: contrail-init
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-cni-init:latest
-          name: contrail-cni-init
-        nodeSelector:
-          node-role.kubernetes.io/master: ""
-    ---
-    apiVersion: dataplane.juniper.net/v1alpha1
-    kind: Vrouter
-    metadata:
-      name: contrail-vrouter-nodes
-      namespace: contrail
-    spec:
-      agent:
-        virtualHostInterface:
-          gateway: GATEWAY
-      common:
-        affinity:
-          nodeAffinity:
-            requiredDuringSchedulingIgnoredDuringExecution:
-              nodeSelectorTerms:
-              - matchExpressions:
-                - key: node-role.kubernetes.io/master
-                  operator: NotIn
-                  values:
-                  - ""
-        containers:
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-vrouter-agent:latest
-          name: contrail-vrouter-agent
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-init:latest
-          name: contrail-watcher
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-telemetry-exporter:latest
-          name: contrail-vrouter-telemetry-exporter
-        initContainers:
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-init:latest
-          name: contrail-init
-        - image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-cni-init:latest
-          name: contrail-cni-init
-kind: ConfigMap
-metadata:
-  creationTimestamp: null
-  name: contrail-cr
-  namespace: contrail
----
-apiVersion: batch/v1
-kind: Job
-metadata:
-  name: apply-contrail
-  namespace: contrail
-spec:
-  backoffLimit: 4
-  template:
-    spec:
-      containers:
-      - command:
-        - sh
-        - -c
-        - until kubectl wait --for condition=established --timeout=60s crd/apiservers.configplane.juniper.net; do echo 'waiting for apiserver crd'; sleep 2; done && until ls /tmp/contrail/contrail-cr.yaml; do sleep 2; echo 'waiting for manifest'; done && kubectl apply -f /tmp/contrail/contrail-cr.yaml && kubectl -n contrail delete job apply-contrail
-        image: svl-artifactory.juniper.net/atom-docker/cn2/bazel-build/dev/contrail-k8s-applier:latest
-        name: applier
-        volumeMounts:
-        - mountPath: /tmp/contrail
-          name: cr-volume
-      hostNetwork: true
-      nodeSelector:
-        node-role.kubernetes.io/master: ""
-      restartPolicy: Never
-      serviceAccountName: contrail-serviceaccount
-      tolerations:
-      - effect: NoSchedule
-        operator: Exists
-      - effect: NoExecute
-        operator: Exists
-      volumes:
-      - configMap:
-          name: contrail-cr
-        name: cr-volume`
+// Config holds the values injected into the deployer manifest.
+type Config struct {
+	Replicas        int
+	Gateway         string
+	Podv4subnet     string
+	Podv6subnet     string
+	Servicev4subnet string
+	Servicev6subnet string
+	Asn             int
+	// Registry and Tag replace the defaults of all CN2 images.
+	Registry string
+	Tag      string
+	// ImageOverrides maps component names to full image references.
+	ImageOverrides map[string]string
+	PullSecrets    []string
+}
+
+// Components are the CN2 image names which can be overridden.
+var Components = []string{
+	"contrail-k8s-deployer",
+	"contrail-k8s-crdloader",
+	"contrail-k8s-applier",
+	"contrail-k8s-apiserver",
+	"contrail-k8s-controller",
+	"contrail-k8s-kubemanager",
+	"contrail-control",
+	"contrail-telemetry-exporter",
+	"contrail-init",
+	"contrail-cni-init",
+	"contrail-vrouter-agent",
+}
+
+// Deployer holds the objects of the deployer manifest. They can be modified
+// before the manifest is rendered.
+type Deployer struct {
+	Namespaces          []*v1.Namespace
+	ServiceAccounts     []*v1.ServiceAccount
+	ClusterRoles        []*rbacv1.ClusterRole
+	ClusterRoleBindings []*rbacv1.ClusterRoleBinding
+	Deployment          *appsv1.Deployment
+	// CustomResources are the CN2 resources applied by Job from the
+	// contrail-cr ConfigMap.
+	CustomResources []*unstructured.Unstructured
+	Job             *batchv1.Job
+}
+
+func NewDeployer(config Config) (*Deployer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Deployer{
+		Namespaces: []*v1.Namespace{
+			defineNamespace(contrailNamespace),
+			defineNamespace(contrailDeployNamespace),
+		},
+		ServiceAccounts: []*v1.ServiceAccount{
+			defineServiceAccount("contrail-serviceaccount", contrailNamespace),
+			defineServiceAccount("contrail-deploy-serviceaccount", contrailDeployNamespace),
+		},
+		ClusterRoles: []*rbacv1.ClusterRole{
+			defineClusterRole("contrail-role"),
+			defineClusterRole("contrail-deploy-role"),
+		},
+		ClusterRoleBindings: []*rbacv1.ClusterRoleBinding{
+			defineClusterRoleBinding("contrail-rolebinding", "contrail-role", "contrail-serviceaccount", contrailNamespace),
+			defineClusterRoleBinding("contrail-deploy-rolebinding", "contrail-deploy-role", "contrail-deploy-serviceaccount", contrailDeployNamespace),
+		},
+		Deployment:      defineDeployment(config),
+		CustomResources: defineCustomResources(config),
+		Job:             defineJob(config),
+	}, nil
+}
+
+// NewClusterDeployer creates the deployer for cl, using the first address
+// of the cluster subnet as vrouter gateway.
+func NewClusterDeployer(cl cluster.Cluster) (*Deployer, error) {
+	ipnet, _, err := net.ParseCIDR(cl.Subnet)
+	if err != nil {
+		return nil, err
+	}
+	ip := ipnet.To4()
+	if ip == nil {
+		return nil, fmt.Errorf("subnet %s is not an IPv4 subnet", cl.Subnet)
+	}
+	ip[3]++
+	return NewDeployer(Config{
+		Replicas:        cl.Count(roles.Controller),
+		Gateway:         ip.String(),
+		Podv4subnet:     cl.Podv4subnet,
+		Podv6subnet:     cl.Podv6subnet,
+		Servicev4subnet: cl.Servicev4subnet,
+		Servicev6subnet: cl.Servicev6subnet,
+		Asn:             cl.Asn,
+		Registry:        cl.Images.Registry,
+		Tag:             cl.Images.Tag,
+		ImageOverrides:  cl.Images.Overrides,
+		PullSecrets:     cl.Images.Pullsecrets,
+	})
+}
+
+func (c Config) Validate() error {
+	var errs []string
+	if c.Replicas < 1 {
+		errs = append(errs, fmt.Sprintf("replicas must be at least 1, got %d", c.Replicas))
+	}
+	if net.ParseIP(c.Gateway) == nil {
+		errs = append(errs, fmt.Sprintf("gateway %q is not an IP address", c.Gateway))
+	}
+	for name, subnet := range map[string]string{
+		"podv4subnet":     c.Podv4subnet,
+		"podv6subnet":     c.Podv6subnet,
+		"servicev4subnet": c.Servicev4subnet,
+		"servicev6subnet": c.Servicev6subnet,
+	} {
+		if subnet == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(subnet); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %q is not a CIDR", name, subnet))
+		}
+	}
+	for component := range c.ImageOverrides {
+		if !contains(Components, component) {
+			errs = append(errs, fmt.Sprintf("unknown image override %q, must be one of %s", component, strings.Join(Components, ", ")))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid deployer config: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// ConfigMap returns the contrail-cr ConfigMap holding the rendered custom
+// resources.
+func (d *Deployer) ConfigMap() (*v1.ConfigMap, error) {
+	var docs []string
+	for _, cr := range d.CustomResources {
+		crByte, err := yaml.Marshal(cr.Object)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, string(crByte))
+	}
+	return &v1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      crConfigMapName,
+			Namespace: contrailNamespace,
+		},
+		Data: map[string]string{
+			crConfigMapKey: strings.Join(docs, "---\n"),
+		},
+	}, nil
+}
+
+// Objects returns all objects in the order they are applied.
+func (d *Deployer) Objects() ([]interface{}, error) {
+	var objects []interface{}
+	for _, obj := range d.Namespaces {
+		objects = append(objects, obj)
+	}
+	for _, obj := range d.ServiceAccounts {
+		objects = append(objects, obj)
+	}
+	for _, obj := range d.ClusterRoles {
+		objects = append(objects, obj)
+	}
+	for _, obj := range d.ClusterRoleBindings {
+		objects = append(objects, obj)
+	}
+	configMap, err := d.ConfigMap()
+	if err != nil {
+		return nil, err
+	}
+	objects = append(objects, d.Deployment, configMap, d.Job)
+	return objects, nil
+}
+
+// Manifest renders all objects as a multi document YAML manifest.
+func (d *Deployer) Manifest() (string, error) {
+	objects, err := d.Objects()
+	if err != nil {
+		return "", err
+	}
+	var docs []string
+	for _, obj := range objects {
+		objByte, err := yaml.Marshal(obj)
+		if err != nil {
+			return "", err
+		}
+		docs = append(docs, string(objByte))
+	}
+	return strings.Join(docs, "---\n"), nil
+}
+
+// image returns the image reference of a CN2 component.
+func (c Config) image(name string) string {
+	if image, ok := c.ImageOverrides[name]; ok {
+		return image
+	}
+	registry := defaultRegistry
+	if c.Registry != "" {
+		registry = strings.TrimSuffix(c.Registry, "/")
+	}
+	tag := defaultTag
+	if c.Tag != "" {
+		tag = c.Tag
+	}
+	return fmt.Sprintf("%s/%s:%s", registry, name, tag)
+}
+
+func (c Config) imagePullSecrets() []v1.LocalObjectReference {
+	var secrets []v1.LocalObjectReference
+	for _, secret := range c.PullSecrets {
+		secrets = append(secrets, v1.LocalObjectReference{Name: secret})
+	}
+	return secrets
+}
 
-func NewDeployer(scale int, gateway, podv4subnet, podv6subnet, servicev4subnet, servicev6subnet string, asn int) string {
-	template := strings.Replace(deployerTemplate, "GATEWAY", gateway, -1)
-	template = strings.Replace(template, "PODV4SUBNET", podv4subnet, -1)
-	template = strings.Replace(template, "PODV6SUBNET", podv6subnet, -1)
-	template = strings.Replace(template, "SERVICEV4SUBNET", servicev4subnet, -1)
-	template = strings.Replace(template, "SERVICEV6SUBNET", servicev6subnet, -1)
-	template = strings.Replace(template, "ASN", strconv.Itoa(asn), -1)
-	return strings.Replace(template, "REPLICAS", strconv.Itoa(scale), -1)
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,148 @@
+package deployer
+
+import (
+	"testing"
+
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testConfig() Config {
+	return Config{
+		Replicas:        3,
+		Gateway:         "10.0.0.1",
+		Podv4subnet:     "10.234.64.0/18",
+		Podv6subnet:     "fd85:ee78:d8a6:8607::2:0/112",
+		Servicev4subnet: "10.234.0.0/18",
+		Servicev6subnet: "fd85:ee78:d8a6:8607::2000/116",
+		Asn:             64512,
+	}
+}
+
+func customResourceByName(t *testing.T, d *Deployer, name string) *unstructured.Unstructured {
+	t.Helper()
+	for _, cr := range d.CustomResources {
+		if cr.GetName() == name {
+			return cr
+		}
+	}
+	t.Fatalf("custom resource %s not found", name)
+	return nil
+}
+
+func nestedString(t *testing.T, cr *unstructured.Unstructured, fields ...string) string {
+	t.Helper()
+	value, found, err := unstructured.NestedString(cr.Object, fields...)
+	if err != nil || !found {
+		t.Fatalf("%s: field %v not found: %v", cr.GetName(), fields, err)
+	}
+	return value
+}
+
+func TestNewDeployer(t *testing.T) {
+	config := testConfig()
+	d, err := NewDeployer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"contrail-k8s-apiserver", "contrail-k8s-controller", "contrail-k8s-kubemanager", "contrail-control"} {
+		replicas, found, err := unstructured.NestedInt64(customResourceByName(t, d, name).Object, "spec", "common", "replicas")
+		if err != nil || !found || replicas != int64(config.Replicas) {
+			t.Errorf("%s: replicas = %d, found %t, err %v, want %d", name, replicas, found, err, config.Replicas)
+		}
+	}
+	kubemanager := customResourceByName(t, d, "contrail-k8s-kubemanager")
+	asn, _, err := unstructured.NestedInt64(kubemanager.Object, "spec", "autonomousSystem")
+	if err != nil || asn != int64(config.Asn) {
+		t.Errorf("autonomousSystem = %d, err %v, want %d", asn, err, config.Asn)
+	}
+	for field, want := range map[string]string{
+		"podV4Subnet":     config.Podv4subnet,
+		"podV6Subnet":     config.Podv6subnet,
+		"serviceV4Subnet": config.Servicev4subnet,
+		"serviceV6Subnet": config.Servicev6subnet,
+	} {
+		if got := nestedString(t, kubemanager, "spec", field); got != want {
+			t.Errorf("%s = %q, want %q", field, got, want)
+		}
+	}
+	for _, name := range []string{"contrail-vrouter-masters", "contrail-vrouter-nodes"} {
+		if got := nestedString(t, customResourceByName(t, d, name), "spec", "agent", "virtualHostInterface", "gateway"); got != config.Gateway {
+			t.Errorf("%s: gateway = %q, want %q", name, got, config.Gateway)
+		}
+	}
+}
+
+func TestNewDeployerWithoutV6Subnets(t *testing.T) {
+	config := testConfig()
+	config.Podv6subnet = ""
+	config.Servicev6subnet = ""
+	d, err := NewDeployer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, _, _ := unstructured.NestedMap(customResourceByName(t, d, "contrail-k8s-kubemanager").Object, "spec")
+	for _, field := range []string{"podV6Subnet", "serviceV6Subnet"} {
+		if _, ok := spec[field]; ok {
+			t.Errorf("%s set without a v6 subnet", field)
+		}
+	}
+}
+
+func TestNewClusterDeployer(t *testing.T) {
+	config := testConfig()
+	d, err := NewClusterDeployer(cluster.Cluster{
+		Controller:      3,
+		Subnet:          "10.0.0.0/24",
+		Podv4subnet:     config.Podv4subnet,
+		Servicev4subnet: config.Servicev4subnet,
+		Asn:             config.Asn,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := nestedString(t, customResourceByName(t, d, "contrail-vrouter-nodes"), "spec", "agent", "virtualHostInterface", "gateway"); got != "10.0.0.1" {
+		t.Errorf("gateway = %q, want 10.0.0.1", got)
+	}
+	if got := *d.Deployment.Spec.Replicas; got != 1 {
+		t.Errorf("deployer replicas = %d, want 1", got)
+	}
+}
+
+func TestImage(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{{
+		name:   "defaults",
+		config: Config{},
+		want:   defaultRegistry + "/contrail-control:" + defaultTag,
+	}, {
+		name:   "registry and tag",
+		config: Config{Registry: "registry.example.com/cn2/", Tag: "22.1"},
+		want:   "registry.example.com/cn2/contrail-control:22.1",
+	}, {
+		name: "override",
+		config: Config{
+			Registry:       "registry.example.com/cn2",
+			Tag:            "22.1",
+			ImageOverrides: map[string]string{"contrail-control": "other.example.com/control:debug"},
+		},
+		want: "other.example.com/control:debug",
+	}, {
+		name: "override of another component",
+		config: Config{
+			Tag:            "22.1",
+			ImageOverrides: map[string]string{"contrail-init": "other.example.com/init:debug"},
+		},
+		want: defaultRegistry + "/contrail-control:22.1",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.image("contrail-control"); got != tt.want {
+				t.Errorf("image() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package deployer
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	masterNodeSelector = map[string]string{masterLabel: ""}
+	tolerations        = []v1.Toleration{{
+		Effect:   v1.TaintEffectNoSchedule,
+		Operator: v1.TolerationOpExists,
+	}, {
+		Effect:   v1.TaintEffectNoExecute,
+		Operator: v1.TolerationOpExists,
+	}}
+)
+
+func defineNamespace(name string) *v1.Namespace {
+	return &v1.Namespace{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Namespace",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+	}
+}
+
+func defineServiceAccount(name, namespace string) *v1.ServiceAccount {
+	return &v1.ServiceAccount{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ServiceAccount",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+}
+
+func defineClusterRole(name string) *rbacv1.ClusterRole {
+	return &rbacv1.ClusterRole{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+			Kind:       "ClusterRole",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups: []string{"*"},
+			Resources: []string{"*"},
+			Verbs:     []string{"*"},
+		}},
+	}
+}
+
+func defineClusterRoleBinding(name, role, serviceAccount, namespace string) *rbacv1.ClusterRoleBinding {
+	return &rbacv1.ClusterRoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+			Kind:       "ClusterRoleBinding",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     role,
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      serviceAccount,
+			Namespace: namespace,
+		}},
+	}
+}
+
+func defineDeployment(config Config) *appsv1.Deployment {
+	var replicas int32 = 1
+	labels := map[string]string{"app": "contrail-k8s-deployer"}
+	return &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: appsv1.SchemeGroupVersion.String(),
+			Kind:       "Deployment",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "contrail-k8s-deployer",
+			Namespace: contrailDeployNamespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{
+						Name:            "contrail-k8s-deployer",
+						Image:           config.image("contrail-k8s-deployer"),
+						ImagePullPolicy: v1.PullAlways,
+						Command:         []string{"sh", "-c", "/manager --metrics-addr 127.0.0.1:8081"},
+					}},
+					InitContainers: []v1.Container{{
+						Name:            "contrail-k8s-crdloader",
+						Image:           config.image("contrail-k8s-crdloader"),
+						ImagePullPolicy: v1.PullAlways,
+						Command:         []string{"sh", "-c", "kustomize build /crd | kubectl apply -f -"},
+					}},
+					HostNetwork:        true,
+					ImagePullSecrets:   config.imagePullSecrets(),
+					NodeSelector:       masterNodeSelector,
+					ServiceAccountName: "contrail-deploy-serviceaccount",
+					Tolerations:        tolerations,
+				},
+			},
+		},
+	}
+}
+
+func defineJob(config Config) *batchv1.Job {
+	var backoffLimit int32 = 4
+	return &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: batchv1.SchemeGroupVersion.String(),
+			Kind:       "Job",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      applyJobName,
+			Namespace: contrailNamespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{
+						Name:  "applier",
+						Image: config.image("contrail-k8s-applier"),
+						Command: []string{"sh", "-c", "until kubectl wait --for condition=established --timeout=60s crd/apiservers.configplane.juniper.net; do echo 'waiting for apiserver crd'; sleep 2; done && " +
+							"until ls /tmp/contrail/contrail-cr.yaml; do sleep 2; echo 'waiting for manifest'; done && " +
+							"kubectl apply -f /tmp/contrail/contrail-cr.yaml && kubectl -n contrail delete job apply-contrail"},
+						VolumeMounts: []v1.VolumeMount{{
+							Name:      "cr-volume",
+							MountPath: "/tmp/contrail",
+						}},
+					}},
+					HostNetwork:        true,
+					ImagePullSecrets:   config.imagePullSecrets(),
+					NodeSelector:       masterNodeSelector,
+					RestartPolicy:      v1.RestartPolicyNever,
+					ServiceAccountName: "contrail-serviceaccount",
+					Tolerations:        tolerations,
+					Volumes: []v1.Volume{{
+						Name: "cr-volume",
+						VolumeSource: v1.VolumeSource{
+							ConfigMap: &v1.ConfigMapVolumeSource{
+								LocalObjectReference: v1.LocalObjectReference{Name: crConfigMapName},
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
@@ -3,7 +3,9 @@ package inventory
 import (
 	"fmt"
 	"net"
+	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 
@@ -11,6 +13,7 @@ import (
 	"github.com/michaelhenkel/cn2kubevirt/deployer"
 	"github.com/michaelhenkel/cn2kubevirt/roles"
 	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog"
 )
 
@@ -53,21 +56,53 @@ type InstanceIPRole struct {
 	Networks []roles.NetworkAnnotation
 }
 
-func NewInventory(instanceMap map[string]InstanceIPRole, cl cluster.Cluster, serviceIP string) error {
+// Addresses returns the address ansible connects to, which is the pod
+// network IP, and the node IP on the cluster network. Secondary networks
+// are ignored.
+func (i InstanceIPRole) Addresses(cl cluster.Cluster) (ansibleHost string, ip string) {
+	for _, nw := range i.Networks {
+		if len(nw.Ips) == 0 {
+			continue
+		}
+		if nw.Name == fmt.Sprintf("%s/%s", cl.Namespace, cl.Name) {
+			ip = nw.Ips[0]
+		} else if nw.Default {
+			ansibleHost = nw.Ips[0]
+		}
+	}
+	return ansibleHost, ip
+}
+
+// NewInventory writes the inventory and the deployer manifest to
+// Kubeconfigdir. The API server certificates are valid for serviceIP and,
+// if the cluster is exposed, the host of externalEndpoint.
+func NewInventory(instanceMap map[string]InstanceIPRole, cl cluster.Cluster, serviceIP, externalEndpoint string) error {
 	var allHosts = make(map[string]Host)
 	var kubeMasterHosts = make(map[string]struct{})
 	var kubeNodeHosts = make(map[string]struct{})
 	var etcdHosts = make(map[string]struct{})
 
+	addresses, err := cl.NodeAddresses()
+	if err != nil {
+		return err
+	}
+	sslAddresses := []string{serviceIP}
+	if externalEndpoint != "" {
+		host, _, err := net.SplitHostPort(externalEndpoint)
+		if err != nil {
+			return err
+		}
+		sslAddresses = append(sslAddresses, host)
+	}
 	for instName, inst := range instanceMap {
-		var ansibleHost string
-		var ip string
-		for _, nw := range inst.Networks {
-			if nw.Name == fmt.Sprintf("%s/%s", cl.Namespace, cl.Name) {
-				ip = nw.Ips[0]
-			} else {
-				ansibleHost = nw.Ips[0]
+		ansibleHost, ip := inst.Addresses(cl)
+		// static addresses keep the inventory stable across re-creations
+		if address, ok := addresses[instName]; ok {
+			staticIP, _, err := net.ParseCIDR(address)
+			if err != nil {
+				return err
 			}
+			ip = staticIP.String()
 		}
 		allHosts[instName] = Host{
 			AnsibleHost: ansibleHost,
@@ -91,8 +126,8 @@ func NewInventory(instanceMap map[string]InstanceIPRole, cl cluster.Cluster, ser
 				"download_run_once":                   "true",
 				"download_localhost":                  "true",
 				"enable_dual_stack_networks":          "true",
-				"ansible_user":                        "root",
-				"docker_image_repo":                   "svl-artifactory.juniper.net/atom-docker-remote",
+				"ansible_user":                        cl.SSHUser(),
+				"docker_image_repo":                   imageRepo(cl),
 				"cluster_name":                        fmt.Sprintf("%s.%s", cl.Name, cl.Suffix),
 				"artifacts_dir":                       cl.Kubeconfigdir,
 				"kube_network_plugin":                 "cni",
@@ -105,7 +140,7 @@ func NewInventory(instanceMap map[string]InstanceIPRole, cl cluster.Cluster, ser
 				"download_container":                  "false",
 				"etcd_deployment_type":                "host",
 				"host_key_checking":                   "false",
-				"supplementary_addresses_in_ssl_keys": "[" + serviceIP + "]",
+				"supplementary_addresses_in_ssl_keys": "[" + strings.Join(sslAddresses, ",") + "]",
 			},
 		},
 		KubeMaster: KubeMaster{
@@ -143,27 +178,95 @@ func NewInventory(instanceMap map[string]InstanceIPRole, cl cluster.Cluster, ser
 	}
 	klog.Infof("created inventory file %s/inventory.yaml", cl.Kubeconfigdir)
 
-	adminConfByte, err := os.ReadFile(cl.Kubeconfigdir + "/admin.conf")
+	d, err := deployer.NewClusterDeployer(cl)
 	if err != nil {
 		return err
 	}
-	r := regexp.MustCompile(`server: https://(.*):6443`)
-	currentIP := r.FindStringSubmatch(string(adminConfByte))
-	adminConfString := strings.Replace(string(string(adminConfByte)), currentIP[1], serviceIP, -1)
-	if err := os.WriteFile(cl.Kubeconfigdir+"/admin.conf", []byte(adminConfString), 0600); err != nil {
-		return err
-	}
-	klog.Infof("created deployer file %s/admin.conf", cl.Kubeconfigdir)
-	ipnet, _, err := net.ParseCIDR(cl.Subnet)
+	deployer, err := d.Manifest()
 	if err != nil {
 		return err
 	}
-	ip := ipnet.To4()
-	ip[3]++
-	deployer := deployer.NewDeployer(cl.Controller, ip.String(), cl.Podv4subnet, cl.Podv6subnet, cl.Servicev4subnet, cl.Servicev6subnet, cl.Asn)
 	if err := os.WriteFile(cl.Kubeconfigdir+"/deployer.yaml", []byte(deployer), 0600); err != nil {
 		return err
 	}
 	klog.Infof("created deployer file %s/deployer.yaml", cl.Kubeconfigdir)
 	return nil
 }
+
+const defaultImageRepo = "svl-artifactory.juniper.net/atom-docker-remote"
+
+func imageRepo(cl cluster.Cluster) string {
+	if cl.Kubespray.Imagerepo != "" {
+		return cl.Kubespray.Imagerepo
+	}
+	return defaultImageRepo
+}
+
+// ExternalKubeconfig is the kubeconfig pointing to the external endpoint
+// of an exposed cluster.
+const ExternalKubeconfig = "admin.external.conf"
+
+// RewriteKubeconfig points every cluster in the admin.conf written by
+// kubespray to endpoint, which is a host or host:port. Without a port the
+// port of the current server is kept. It does nothing before kubespray
+// created the file or if the servers already point to endpoint.
+func RewriteKubeconfig(cl cluster.Cluster, endpoint string) error {
+	path := filepath.Join(cl.Kubeconfigdir, "admin.conf")
+	return rewriteKubeconfig(path, path, endpoint)
+}
+
+// WriteExternalKubeconfig writes a copy of admin.conf pointing to the
+// external endpoint of the cluster. Like RewriteKubeconfig it does nothing
+// before kubespray created admin.conf.
+func WriteExternalKubeconfig(cl cluster.Cluster, endpoint string) error {
+	return rewriteKubeconfig(filepath.Join(cl.Kubeconfigdir, "admin.conf"), filepath.Join(cl.Kubeconfigdir, ExternalKubeconfig), endpoint)
+}
+
+func rewriteKubeconfig(src, dst, endpoint string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+	config, err := clientcmd.LoadFromFile(src)
+	if err != nil {
+		return err
+	}
+	var changed bool
+	for name, c := range config.Clusters {
+		server, err := rewriteServer(c.Server, endpoint)
+		if err != nil {
+			return fmt.Errorf("cluster %s in %s: %w", name, src, err)
+		}
+		if server != c.Server {
+			c.Server = server
+			changed = true
+		}
+	}
+	if !changed && src == dst {
+		return nil
+	}
+	if err := clientcmd.WriteToFile(*config, dst); err != nil {
+		return err
+	}
+	klog.Infof("pointed %s to %s", dst, endpoint)
+	return nil
+}
+
+func rewriteServer(server, endpoint string) (string, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid server %q", server)
+	}
+	port := u.Port()
+	u.Host = endpoint
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		if port != "" {
+			u.Host = net.JoinHostPort(endpoint, port)
+		} else if strings.Contains(endpoint, ":") {
+			u.Host = "[" + endpoint + "]"
+		}
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,130 @@
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: cluster.local
+  cluster:
+    server: https://192.168.1.5:6443
+    certificate-authority-data: dGVzdA==
+- name: other
+  cluster:
+    server: https://192.168.1.6:6443
+contexts:
+- name: admin
+  context:
+    cluster: cluster.local
+    user: admin
+current-context: admin
+users:
+- name: admin
+  user:
+    token: secret
+`
+
+func TestRewriteServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   string
+		endpoint string
+		want     string
+	}{{
+		name:     "host only keeps the port",
+		server:   "https://192.168.1.5:6443",
+		endpoint: "10.0.0.1",
+		want:     "https://10.0.0.1:6443",
+	}, {
+		name:     "host and port",
+		server:   "https://192.168.1.5:6443",
+		endpoint: "api.example.com:443",
+		want:     "https://api.example.com:443",
+	}, {
+		name:     "bare IPv6",
+		server:   "https://192.168.1.5:6443",
+		endpoint: "fd00::1",
+		want:     "https://[fd00::1]:6443",
+	}, {
+		name:     "bare IPv6 without port",
+		server:   "https://192.168.1.5",
+		endpoint: "fd00::1",
+		want:     "https://[fd00::1]",
+	}, {
+		name:     "unchanged",
+		server:   "https://10.0.0.1:6443",
+		endpoint: "10.0.0.1",
+		want:     "https://10.0.0.1:6443",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rewriteServer(tt.server, tt.endpoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("rewriteServer(%q, %q) = %q, want %q", tt.server, tt.endpoint, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteKubeconfigMissingFile(t *testing.T) {
+	cl := cluster.Cluster{Kubeconfigdir: t.TempDir()}
+	if err := RewriteKubeconfig(cl, "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteExternalKubeconfig(cl, "api.example.com:443"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"admin.conf", ExternalKubeconfig} {
+		if _, err := os.Stat(filepath.Join(cl.Kubeconfigdir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s created without admin.conf", name)
+		}
+	}
+}
+
+func TestRewriteKubeconfig(t *testing.T) {
+	cl := cluster.Cluster{Kubeconfigdir: t.TempDir()}
+	path := filepath.Join(cl.Kubeconfigdir, "admin.conf")
+	if err := os.WriteFile(path, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := RewriteKubeconfig(cl, "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+		config, err := clientcmd.LoadFromFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, c := range config.Clusters {
+			if c.Server != "https://10.0.0.1:6443" {
+				t.Errorf("run %d: cluster %s server = %q, want https://10.0.0.1:6443", i, name, c.Server)
+			}
+		}
+		if got := string(config.Clusters["cluster.local"].CertificateAuthorityData); got != "test" {
+			t.Errorf("run %d: certificate authority data = %q, want test", i, got)
+		}
+		if config.AuthInfos["admin"].Token != "secret" {
+			t.Errorf("run %d: user token lost", i)
+		}
+	}
+	if err := WriteExternalKubeconfig(cl, "api.example.com:443"); err != nil {
+		t.Fatal(err)
+	}
+	external, err := clientcmd.LoadFromFile(filepath.Join(cl.Kubeconfigdir, ExternalKubeconfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := external.Clusters["cluster.local"].Server; got != "https://api.example.com:443" {
+		t.Errorf("external server = %q, want https://api.example.com:443", got)
+	}
+}
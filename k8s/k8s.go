@@ -1,27 +1,28 @@
 package k8s
 
 import (
-	"path/filepath"
-
 	nadClientset "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/clientset/versioned"
+	apiextensionsClientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
 	"kubevirt.io/client-go/kubecli"
 )
 
 type Client struct {
-	K8S      *kubernetes.Clientset
-	Kubevirt kubecli.KubevirtClient
-	Nad      *nadClientset.Clientset
+	K8S           *kubernetes.Clientset
+	Kubevirt      kubecli.KubevirtClient
+	Nad           *nadClientset.Clientset
+	Dynamic       dynamic.Interface
+	Apiextensions *apiextensionsClientset.Clientset
 }
 
-func NewClient() (*Client, error) {
-	var kubeconfig string
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = filepath.Join(home, ".kube", "config")
-	}
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+// NewClient creates a client for the host cluster. kubeconfig and context
+// override the defaults from KUBECONFIG and ~/.kube/config. Without any
+// kubeconfig the in-cluster config is used.
+func NewClient(kubeconfig, context string) (*Client, error) {
+	config, err := restConfig(kubeconfig, context)
 	if err != nil {
 		return nil, err
 	}
@@ -34,9 +35,38 @@ func NewClient() (*Client, error) {
 		return nil, err
 	}
 	nadClient, err := nadClientset.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	apiextensionsClient, err := apiextensionsClientset.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
 	return &Client{
-		K8S:      clientset,
-		Kubevirt: kubevirtClient,
-		Nad:      nadClient,
+		K8S:           clientset,
+		Kubevirt:      kubevirtClient,
+		Nad:           nadClient,
+		Dynamic:       dynamicClient,
+		Apiextensions: apiextensionsClient,
 	}, nil
 }
+
+func restConfig(kubeconfig, context string) (*rest.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: context,
+	}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	if err == nil {
+		return config, nil
+	}
+	if kubeconfig == "" && context == "" && clientcmd.IsEmptyConfig(err) {
+		return rest.InClusterConfig()
+	}
+	return nil, err
+}
@@ -0,0 +1,215 @@
+package kubespray
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	hd "github.com/mitchellh/go-homedir"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+)
+
+const (
+	DefaultImage = "quay.io/kubespray/kubespray:v2.16.0"
+	// KubeconfigKey is the key of the admin.conf in the kubeconfig Secret.
+	KubeconfigKey = "admin.conf"
+	pollInterval  = 5 * time.Second
+	podTimeout    = 10 * time.Minute
+)
+
+// Name returns the name shared by the Job and its ConfigMap, Secret and
+// RBAC objects.
+func Name(cl *cluster.Cluster) string {
+	return fmt.Sprintf("%s-kubespray", cl.Name)
+}
+
+// KubeconfigSecretName returns the name of the Secret the Job stores the
+// admin.conf of the new cluster in.
+func KubeconfigSecretName(cl *cluster.Cluster) string {
+	return fmt.Sprintf("%s-kubeconfig", cl.Name)
+}
+
+// Install runs kubespray's cluster.yml against the generated inventory in
+// a Job inside the cluster namespace, streams its logs and writes the
+// resulting admin.conf to Kubeconfigdir.
+func Install(client *k8s.Client, cl *cluster.Cluster) error {
+	if err := Delete(client, cl); err != nil {
+		return err
+	}
+	inventoryByte, err := os.ReadFile(filepath.Join(cl.Kubeconfigdir, "inventory.yaml"))
+	if err != nil {
+		return err
+	}
+	keypath, err := hd.Expand(cl.PrivateKeypath())
+	if err != nil {
+		return err
+	}
+	keyByte, err := os.ReadFile(keypath)
+	if err != nil {
+		return fmt.Errorf("ssh private key: %s", err)
+	}
+	ctx := context.Background()
+	if _, err := client.K8S.CoreV1().ConfigMaps(cl.Namespace).Create(ctx, defineConfigMap(cl, inventoryByte), metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	if _, err := client.K8S.CoreV1().Secrets(cl.Namespace).Create(ctx, defineSecret(cl, keyByte), metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	if _, err := client.K8S.CoreV1().ServiceAccounts(cl.Namespace).Create(ctx, defineServiceAccount(cl), metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	if _, err := client.K8S.RbacV1().Roles(cl.Namespace).Create(ctx, defineRole(cl), metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	if _, err := client.K8S.RbacV1().RoleBindings(cl.Namespace).Create(ctx, defineRoleBinding(cl), metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	if _, err := client.K8S.BatchV1().Jobs(cl.Namespace).Create(ctx, defineJob(cl), metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	klog.Infof("started kubespray job %s/%s", cl.Namespace, Name(cl))
+	pod, err := waitForPod(client, cl)
+	if err != nil {
+		return err
+	}
+	if err := streamLogs(client, pod); err != nil {
+		return err
+	}
+	if err := waitForJob(client, cl); err != nil {
+		return err
+	}
+	return FetchKubeconfig(client, cl)
+}
+
+// FetchKubeconfig writes the admin.conf stored by the kubespray Job to
+// Kubeconfigdir.
+func FetchKubeconfig(client *k8s.Client, cl *cluster.Cluster) error {
+	secret, err := client.K8S.CoreV1().Secrets(cl.Namespace).Get(context.Background(), KubeconfigSecretName(cl), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	adminConf, ok := secret.Data[KubeconfigKey]
+	if !ok {
+		return fmt.Errorf("secret %s/%s has no %s", cl.Namespace, secret.Name, KubeconfigKey)
+	}
+	if err := os.MkdirAll(cl.Kubeconfigdir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(cl.Kubeconfigdir, KubeconfigKey), adminConf, 0600); err != nil {
+		return err
+	}
+	klog.Infof("fetched %s/%s", cl.Kubeconfigdir, KubeconfigKey)
+	return nil
+}
+
+// Delete removes the kubespray Job and the objects created for it. The
+// kubeconfig Secret is kept.
+func Delete(client *k8s.Client, cl *cluster.Cluster) error {
+	ctx := context.Background()
+	name := Name(cl)
+	propagation := metav1.DeletePropagationForeground
+	err := client.K8S.BatchV1().Jobs(cl.Namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	// the job has to be gone before it can be recreated with the same name
+	err = wait.PollImmediate(time.Second, podTimeout, func() (bool, error) {
+		_, err := client.K8S.BatchV1().Jobs(cl.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return err
+	}
+	deleteFuncs := []func() error{
+		func() error {
+			return client.K8S.CoreV1().ConfigMaps(cl.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		},
+		func() error {
+			return client.K8S.CoreV1().Secrets(cl.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		},
+		func() error {
+			return client.K8S.CoreV1().ServiceAccounts(cl.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		},
+		func() error { return client.K8S.RbacV1().Roles(cl.Namespace).Delete(ctx, name, metav1.DeleteOptions{}) },
+		func() error {
+			return client.K8S.RbacV1().RoleBindings(cl.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		},
+	}
+	for _, deleteFunc := range deleteFuncs {
+		if err := deleteFunc(); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func waitForPod(client *k8s.Client, cl *cluster.Cluster) (*v1.Pod, error) {
+	var pod *v1.Pod
+	err := wait.PollImmediate(pollInterval, podTimeout, func() (bool, error) {
+		podList, err := client.K8S.CoreV1().Pods(cl.Namespace).List(context.Background(), metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("job-name=%s", Name(cl)),
+		})
+		if err != nil {
+			return false, err
+		}
+		for idx := range podList.Items {
+			switch podList.Items[idx].Status.Phase {
+			case v1.PodRunning, v1.PodSucceeded, v1.PodFailed:
+				pod = &podList.Items[idx]
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, fmt.Errorf("kubespray pod not started after %s", podTimeout)
+	}
+	return pod, err
+}
+
+func streamLogs(client *k8s.Client, pod *v1.Pod) error {
+	stream, err := client.K8S.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{
+		Follow: true,
+	}).Stream(context.Background())
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	_, err = io.Copy(os.Stdout, stream)
+	return err
+}
+
+func waitForJob(client *k8s.Client, cl *cluster.Cluster) error {
+	var failed bool
+	err := wait.PollImmediate(pollInterval, podTimeout, func() (bool, error) {
+		job, err := client.K8S.BatchV1().Jobs(cl.Namespace).Get(context.Background(), Name(cl), metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if job.Status.Failed > 0 {
+			failed = true
+			return true, nil
+		}
+		return job.Status.Succeeded > 0, nil
+	})
+	if err != nil {
+		return err
+	}
+	if failed {
+		return fmt.Errorf("kubespray job %s/%s failed", cl.Namespace, Name(cl))
+	}
+	klog.Infof("kubespray job %s/%s succeeded", cl.Namespace, Name(cl))
+	return nil
+}
@@ -0,0 +1,154 @@
+package kubespray
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	inventoryPath = "/inventory"
+	artifactsPath = "/artifacts"
+	sshPath       = "/ssh"
+	sshKey        = "id_rsa"
+)
+
+func objectMeta(cl *cluster.Cluster, name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: cl.Namespace,
+		Labels:    map[string]string{"cluster": cl.Name},
+	}
+}
+
+func defineConfigMap(cl *cluster.Cluster, inventory []byte) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: objectMeta(cl, Name(cl)),
+		Data: map[string]string{
+			"inventory.yaml": string(inventory),
+		},
+	}
+}
+
+func defineSecret(cl *cluster.Cluster, key []byte) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: objectMeta(cl, Name(cl)),
+		Data: map[string][]byte{
+			sshKey: key,
+		},
+	}
+}
+
+func defineServiceAccount(cl *cluster.Cluster) *v1.ServiceAccount {
+	return &v1.ServiceAccount{
+		ObjectMeta: objectMeta(cl, Name(cl)),
+	}
+}
+
+// defineRole allows the Job to store the admin.conf in a Secret.
+func defineRole(cl *cluster.Cluster) *rbacv1.Role {
+	return &rbacv1.Role{
+		ObjectMeta: objectMeta(cl, Name(cl)),
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups: []string{""},
+			Resources: []string{"secrets"},
+			Verbs:     []string{"get", "create", "update", "patch"},
+		}},
+	}
+}
+
+func defineRoleBinding(cl *cluster.Cluster) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		ObjectMeta: objectMeta(cl, Name(cl)),
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     Name(cl),
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      Name(cl),
+			Namespace: cl.Namespace,
+		}},
+	}
+}
+
+func defineJob(cl *cluster.Cluster) *batchv1.Job {
+	image := cl.Kubespray.Image
+	if image == "" {
+		image = DefaultImage
+	}
+	var backoffLimit int32 = 0
+	var keyMode int32 = 0400
+	// kubespray writes admin.conf to artifacts_dir. The inventory points it
+	// at Kubeconfigdir on the workstation, in the Job it is overridden with
+	// a directory of the container, from where admin.conf is stored in the
+	// kubeconfig Secret.
+	script := fmt.Sprintf(`ansible-playbook -i %s -b --private-key %s -e artifacts_dir=%s cluster.yml && \
+kubectl -n %s create secret generic %s --from-file=%s=%s --dry-run=client -o yaml | kubectl apply -f - && \
+kubectl -n %s label --overwrite secret %s cluster=%s`,
+		filepath.Join(inventoryPath, "inventory.yaml"), filepath.Join(sshPath, sshKey), artifactsPath,
+		cl.Namespace, KubeconfigSecretName(cl), KubeconfigKey, filepath.Join(artifactsPath, KubeconfigKey),
+		cl.Namespace, KubeconfigSecretName(cl), cl.Name)
+	return &batchv1.Job{
+		ObjectMeta: objectMeta(cl, Name(cl)),
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"cluster": cl.Name, "app": "kubespray"},
+				},
+				Spec: v1.PodSpec{
+					ServiceAccountName: Name(cl),
+					RestartPolicy:      v1.RestartPolicyNever,
+					Containers: []v1.Container{{
+						Name:       "kubespray",
+						Image:      image,
+						WorkingDir: "/kubespray",
+						Command:    []string{"sh", "-c", script},
+						Env: []v1.EnvVar{{
+							Name:  "ANSIBLE_HOST_KEY_CHECKING",
+							Value: "False",
+						}},
+						VolumeMounts: []v1.VolumeMount{{
+							Name:      "inventory",
+							MountPath: inventoryPath,
+						}, {
+							Name:      "artifacts",
+							MountPath: artifactsPath,
+						}, {
+							Name:      "ssh",
+							MountPath: sshPath,
+						}},
+					}},
+					Volumes: []v1.Volume{{
+						Name: "inventory",
+						VolumeSource: v1.VolumeSource{
+							ConfigMap: &v1.ConfigMapVolumeSource{
+								LocalObjectReference: v1.LocalObjectReference{Name: Name(cl)},
+							},
+						},
+					}, {
+						Name: "artifacts",
+						VolumeSource: v1.VolumeSource{
+							EmptyDir: &v1.EmptyDirVolumeSource{},
+						},
+					}, {
+						Name: "ssh",
+						VolumeSource: v1.VolumeSource{
+							Secret: &v1.SecretVolumeSource{
+								SecretName:  Name(cl),
+								DefaultMode: &keyMode,
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,299 @@
+package kubevirt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog"
+)
+
+const (
+	apiPort     = 6443
+	tlsPort     = 443
+	exposeWait  = 5 * time.Minute
+	exposePoll  = 5 * time.Second
+	passthrough = "nginx.ingress.kubernetes.io/ssl-passthrough"
+)
+
+var ingressGroupVersionResource = networkingv1.SchemeGroupVersion.WithResource("ingresses")
+
+var routeGroupVersionResource = schema.GroupVersionResource{
+	Group:    "route.openshift.io",
+	Version:  "v1",
+	Resource: "routes",
+}
+
+// DefineIngress defines an Ingress passing the TLS connections for host
+// through to the API service.
+func DefineIngress(cl *cluster.Cluster) *networkingv1.Ingress {
+	annotations := map[string]string{
+		passthrough: "true",
+		"nginx.ingress.kubernetes.io/backend-protocol": "HTTPS",
+	}
+	for k, v := range cl.Expose.Annotations {
+		annotations[k] = v
+	}
+	pathType := networkingv1.PathTypePrefix
+	ingress := &networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "networking.k8s.io/v1",
+			Kind:       "Ingress",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        cl.Name,
+			Namespace:   cl.Namespace,
+			Labels:      map[string]string{"cluster": cl.Name},
+			Annotations: annotations,
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{
+				Host: cl.Expose.Host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{{
+							Path:     "/",
+							PathType: &pathType,
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: cl.Name,
+									Port: networkingv1.ServiceBackendPort{
+										Number: apiPort,
+									},
+								},
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+	if cl.Expose.Ingressclass != "" {
+		ingress.Spec.IngressClassName = &cl.Expose.Ingressclass
+	}
+	return ingress
+}
+
+// DefineRoute defines an OpenShift Route passing the TLS connections for
+// host through to the API service.
+func DefineRoute(cl *cluster.Cluster) *unstructured.Unstructured {
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "route.openshift.io/v1",
+		"kind":       "Route",
+		"metadata": map[string]interface{}{
+			"name":      cl.Name,
+			"namespace": cl.Namespace,
+			"labels":    map[string]interface{}{"cluster": cl.Name},
+		},
+		"spec": map[string]interface{}{
+			"host": cl.Expose.Host,
+			"to": map[string]interface{}{
+				"kind": "Service",
+				"name": cl.Name,
+			},
+			"port": map[string]interface{}{
+				"targetPort": "api",
+			},
+			"tls": map[string]interface{}{
+				"termination": "passthrough",
+			},
+		},
+	}}
+	if len(cl.Expose.Annotations) > 0 {
+		route.SetAnnotations(cl.Expose.Annotations)
+	}
+	return route
+}
+
+// ExternalEndpoint returns the host:port the API server is reachable on from
+// outside the host cluster. It is empty if the cluster is not exposed or the
+// LoadBalancer has no address yet.
+func ExternalEndpoint(client *k8s.Client, cl *cluster.Cluster, svc *v1.Service) (string, error) {
+	switch cl.Expose.Type {
+	case cluster.ExposeNodePort:
+		if len(svc.Spec.Ports) == 0 || svc.Spec.Ports[0].NodePort == 0 {
+			return "", nil
+		}
+		host := cl.Expose.Host
+		if host == "" {
+			var err error
+			if host, err = nodeAddress(client); err != nil {
+				return "", err
+			}
+		}
+		return net.JoinHostPort(host, strconv.Itoa(int(svc.Spec.Ports[0].NodePort))), nil
+	case cluster.ExposeLoadBalancer:
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				return net.JoinHostPort(ingress.IP, strconv.Itoa(apiPort)), nil
+			}
+			if ingress.Hostname != "" {
+				return net.JoinHostPort(ingress.Hostname, strconv.Itoa(apiPort)), nil
+			}
+		}
+		return "", nil
+	case cluster.ExposeIngress, cluster.ExposeRoute:
+		return net.JoinHostPort(cl.Expose.Host, strconv.Itoa(tlsPort)), nil
+	}
+	return "", nil
+}
+
+// WaitForExternalEndpoint waits until the API service of an exposed cluster
+// has an external endpoint and returns it.
+func WaitForExternalEndpoint(client *k8s.Client, cl *cluster.Cluster) (string, error) {
+	if cl.Expose.Type == "" {
+		return "", nil
+	}
+	var endpoint string
+	err := wait.PollImmediate(exposePoll, exposeWait, func() (bool, error) {
+		svc, err := client.K8S.CoreV1().Services(cl.Namespace).Get(context.Background(), cl.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		endpoint, err = ExternalEndpoint(client, cl, svc)
+		return endpoint != "", err
+	})
+	if err == wait.ErrWaitTimeout {
+		return "", fmt.Errorf("service %s/%s has no external address after %s", cl.Namespace, cl.Name, exposeWait)
+	}
+	return endpoint, err
+}
+
+// nodeAddress returns the external or else the internal address of the
+// first host node.
+func nodeAddress(client *k8s.Client) (string, error) {
+	nodes, err := client.K8S.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, addressType := range []v1.NodeAddressType{v1.NodeExternalIP, v1.NodeInternalIP} {
+		for _, node := range nodes.Items {
+			for _, address := range node.Status.Addresses {
+				if address.Type == addressType {
+					return address.Address, nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("no host node has an address")
+}
+
+// createExposure creates the Ingress or Route of the cluster or updates its
+// spec and annotations if they changed. The one of a previous exposure type
+// is deleted.
+func createExposure(client *k8s.Client, cl *cluster.Cluster) error {
+	if err := deleteExposure(client, cl, cl.Expose.Type); err != nil {
+		return err
+	}
+	switch cl.Expose.Type {
+	case cluster.ExposeIngress:
+		desired := DefineIngress(cl)
+		ingress, err := client.K8S.NetworkingV1().Ingresses(cl.Namespace).Get(context.Background(), cl.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			_, err = client.K8S.NetworkingV1().Ingresses(cl.Namespace).Create(context.Background(), desired, metav1.CreateOptions{})
+			return err
+		} else if err != nil {
+			return err
+		}
+		changed := updateAnnotations(&ingress.ObjectMeta, desired.Annotations)
+		if !equality.Semantic.DeepEqual(ingress.Spec, desired.Spec) {
+			ingress.Spec = desired.Spec
+			changed = true
+		}
+		if !changed {
+			return nil
+		}
+		klog.Infof("updating ingress %s/%s", cl.Namespace, cl.Name)
+		_, err = client.K8S.NetworkingV1().Ingresses(cl.Namespace).Update(context.Background(), ingress, metav1.UpdateOptions{})
+		return err
+	case cluster.ExposeRoute:
+		desired := DefineRoute(cl)
+		route, err := client.Dynamic.Resource(routeGroupVersionResource).Namespace(cl.Namespace).Get(context.Background(), cl.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			_, err = client.Dynamic.Resource(routeGroupVersionResource).Namespace(cl.Namespace).Create(context.Background(), desired, metav1.CreateOptions{})
+			return err
+		} else if err != nil {
+			return err
+		}
+		meta := metav1.ObjectMeta{Annotations: route.GetAnnotations()}
+		changed := updateAnnotations(&meta, desired.GetAnnotations())
+		route.SetAnnotations(meta.Annotations)
+		// the router fills in defaults like the weight, so only the
+		// fields set by DefineRoute are compared
+		spec, _, _ := unstructured.NestedMap(route.Object, "spec")
+		desiredSpec, _, _ := unstructured.NestedMap(desired.Object, "spec")
+		if !containsFields(spec, desiredSpec) {
+			if spec == nil {
+				spec = make(map[string]interface{})
+			}
+			for k, v := range desiredSpec {
+				spec[k] = v
+			}
+			if err := unstructured.SetNestedMap(route.Object, spec, "spec"); err != nil {
+				return err
+			}
+			changed = true
+		}
+		if !changed {
+			return nil
+		}
+		klog.Infof("updating route %s/%s", cl.Namespace, cl.Name)
+		_, err = client.Dynamic.Resource(routeGroupVersionResource).Namespace(cl.Namespace).Update(context.Background(), route, metav1.UpdateOptions{})
+		return err
+	}
+	return nil
+}
+
+// containsFields reports whether current has all fields of desired with the
+// same values.
+func containsFields(current, desired interface{}) bool {
+	desiredMap, ok := desired.(map[string]interface{})
+	if !ok {
+		return equality.Semantic.DeepEqual(current, desired)
+	}
+	currentMap, ok := current.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for k, v := range desiredMap {
+		if !containsFields(currentMap[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// deleteExposure deletes the Ingress and Route of the cluster except the one
+// of type keep. Both are deleted by name, a changed or invalid spec doesn't
+// leave one behind. A missing Route API is not found as well.
+func deleteExposure(client *k8s.Client, cl *cluster.Cluster, keep cluster.ExposeType) error {
+	for exposeType, resource := range map[cluster.ExposeType]dynamic.NamespaceableResourceInterface{
+		cluster.ExposeIngress: client.Dynamic.Resource(ingressGroupVersionResource),
+		cluster.ExposeRoute:   client.Dynamic.Resource(routeGroupVersionResource),
+	} {
+		if exposeType == keep {
+			continue
+		}
+		err := resource.Namespace(cl.Namespace).Delete(context.Background(), cl.Name, metav1.DeleteOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		klog.Infof("deleted %s %s/%s", exposeType, cl.Namespace, cl.Name)
+	}
+	return nil
+}
@@ -4,25 +4,35 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/michaelhenkel/cn2kubevirt/cloudinit"
 	"github.com/michaelhenkel/cn2kubevirt/cluster"
 	"github.com/michaelhenkel/cn2kubevirt/inventory"
 	"github.com/michaelhenkel/cn2kubevirt/k8s"
 	"github.com/michaelhenkel/cn2kubevirt/roles"
-	hd "github.com/mitchellh/go-homedir"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog"
 	kubevirtV1 "kubevirt.io/client-go/api/v1"
 	"kubevirt.io/client-go/kubecli"
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
 )
 
 type KubevirtCluster struct {
 	VirtualMachineInstances []*kubevirtV1.VirtualMachineInstance
+	// VirtualMachines wrap the VirtualMachineInstances unless the cluster
+	// is configured for bare VirtualMachineInstances.
+	VirtualMachines []*kubevirtV1.VirtualMachine
+	// DataVolumes hold the root disks of the nodes in datavolume disk mode.
+	// VirtualMachines carry them as DataVolumeTemplates, so they are only
+	// created separately for bare VirtualMachineInstances.
+	DataVolumes []*cdiv1.DataVolume
 }
 
 type Node struct {
@@ -35,115 +45,423 @@ type NetworkAnnotation struct {
 	Ips       []string
 }
 
-func (k *KubevirtCluster) Create(client kubecli.KubevirtClient) error {
+// Create creates all VirtualMachines, or VirtualMachineInstances when no
+// VirtualMachines are defined, which don't exist yet and returns the names
+// of the created ones.
+func (k *KubevirtCluster) Create(client kubecli.KubevirtClient) ([]string, error) {
+	var created []string
+	if len(k.VirtualMachines) > 0 {
+		for _, vm := range k.VirtualMachines {
+			_, err := client.VirtualMachine(vm.Namespace).Get(vm.Name, &metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				_, err := client.VirtualMachine(vm.Namespace).Create(vm)
+				if err != nil {
+					return nil, err
+				}
+				created = append(created, vm.Name)
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		return created, nil
+	}
+	for _, dv := range k.DataVolumes {
+		_, err := client.CdiClient().CdiV1alpha1().DataVolumes(dv.Namespace).Get(context.Background(), dv.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			_, err := client.CdiClient().CdiV1alpha1().DataVolumes(dv.Namespace).Create(context.Background(), dv, metav1.CreateOptions{})
+			if err != nil {
+				return nil, err
+			}
+		} else if err != nil {
+			return nil, err
+		}
+	}
 	for _, vmi := range k.VirtualMachineInstances {
 		_, err := client.VirtualMachineInstance(vmi.Namespace).Get(vmi.Name, &metav1.GetOptions{})
 		if errors.IsNotFound(err) {
 			_, err := client.VirtualMachineInstance(vmi.Namespace).Create(vmi)
 			if err != nil {
-				return err
+				return nil, err
 			}
+			created = append(created, vmi.Name)
 		} else if err != nil {
-			return err
+			return nil, err
 		}
 	}
-	return nil
+	return created, nil
 }
 
-func (k *KubevirtCluster) Watch(client *k8s.Client, cl *cluster.Cluster) (map[string]inventory.InstanceIPRole, error) {
-	readyCount := 0
-	podList, err := client.K8S.CoreV1().Pods(cl.Namespace).List(context.Background(), metav1.ListOptions{
+// Prune deletes the VirtualMachines and VirtualMachineInstances of the
+// cluster which are not part of k, e.g. after the worker count was reduced,
+// and returns their names.
+func (k *KubevirtCluster) Prune(client *k8s.Client, cl *cluster.Cluster) ([]string, error) {
+	listOptions := &metav1.ListOptions{
 		LabelSelector: fmt.Sprintf("cluster=%s", cl.Name),
+	}
+	var wanted = make(map[string]struct{})
+	for _, vmi := range k.VirtualMachineInstances {
+		wanted[vmi.Name] = struct{}{}
+	}
+	var pruned = make(map[string]struct{})
+	vmList, err := client.Kubevirt.VirtualMachine(cl.Namespace).List(listOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, vm := range vmList.Items {
+		if _, ok := wanted[vm.Name]; !ok {
+			if err := deleteVM(client, &vm); err != nil {
+				return nil, err
+			}
+			pruned[vm.Name] = struct{}{}
+		}
+	}
+	vmiList, err := client.Kubevirt.VirtualMachineInstance(cl.Namespace).List(listOptions)
+	if err != nil {
+		return nil, err
+	}
+	var pruneList []kubevirtV1.VirtualMachineInstance
+	for _, vmi := range vmiList.Items {
+		if _, ok := wanted[vmi.Name]; !ok {
+			pruneList = append(pruneList, vmi)
+			pruned[vmi.Name] = struct{}{}
+		}
+	}
+	if err := deleteVMIs(client, cl, pruneList); err != nil {
+		return nil, err
+	}
+	var wantedDataVolumes = make(map[string]struct{})
+	for _, dv := range k.DataVolumes {
+		wantedDataVolumes[dv.Name] = struct{}{}
+	}
+	for _, vm := range k.VirtualMachines {
+		for _, dv := range vm.Spec.DataVolumeTemplates {
+			wantedDataVolumes[dv.Name] = struct{}{}
+		}
+	}
+	if err := deleteDataVolumes(client, cl, wantedDataVolumes); err != nil {
+		return nil, err
+	}
+	var prunedList []string
+	for name := range pruned {
+		prunedList = append(prunedList, name)
+	}
+	sort.Strings(prunedList)
+	return prunedList, nil
+}
+
+// Delete removes all VirtualMachines and VirtualMachineInstances labelled
+// with the cluster name and blocks until their virt-launcher pods are gone.
+func Delete(client *k8s.Client, cl *cluster.Cluster) error {
+	var pods []string
+	err := wait.PollImmediate(terminationInterval, terminationTimeout, func() (bool, error) {
+		var err error
+		pods, err = DeleteNodes(client, cl)
+		return len(pods) == 0, err
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("virt-launcher pods not terminated after %s: %s", terminationTimeout, strings.Join(pods, ", "))
+	}
+	return err
+}
+
+// DeleteNodes deletes the VirtualMachines, VirtualMachineInstances and
+// DataVolumes labelled with the cluster name without waiting and returns
+// the virt-launcher pods which are still terminating. It is called again
+// until no pods are left.
+func DeleteNodes(client *k8s.Client, cl *cluster.Cluster) ([]string, error) {
+	selector := fmt.Sprintf("cluster=%s", cl.Name)
+	vmList, err := client.Kubevirt.VirtualMachine(cl.Namespace).List(&metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	for _, vm := range vmList.Items {
+		if vm.DeletionTimestamp != nil {
+			continue
+		}
+		if err := deleteVM(client, &vm); err != nil {
+			return nil, err
+		}
+	}
+	vmiList, err := client.Kubevirt.VirtualMachineInstance(cl.Namespace).List(&metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	for _, vmi := range vmiList.Items {
+		if vmi.DeletionTimestamp != nil {
+			continue
+		}
+		if err := client.Kubevirt.VirtualMachineInstance(vmi.Namespace).Delete(vmi.Name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		klog.Infof("deleted vmi %s/%s", vmi.Namespace, vmi.Name)
+	}
+	if err := deleteDataVolumes(client, cl, nil); err != nil {
+		return nil, err
+	}
+	podList, err := client.K8S.CoreV1().Pods(cl.Namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s,%s=virt-launcher", selector, kubevirtV1.AppLabel),
 	})
 	if err != nil {
 		return nil, err
 	}
+	var pods []string
 	for _, pod := range podList.Items {
-		if pod.Status.Phase == "Running" {
-			readyCount++
+		pods = append(pods, pod.Name)
+	}
+	sort.Strings(pods)
+	return pods, nil
+}
+
+// deleteDataVolumes deletes the DataVolumes of the cluster except for the
+// ones in keep. DataVolumes owned by VirtualMachines are garbage collected
+// anyway, but bare VirtualMachineInstances leave theirs behind.
+func deleteDataVolumes(client *k8s.Client, cl *cluster.Cluster, keep map[string]struct{}) error {
+	dvList, err := client.Kubevirt.CdiClient().CdiV1alpha1().DataVolumes(cl.Namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("cluster=%s", cl.Name),
+	})
+	if err != nil {
+		return err
+	}
+	for _, dv := range dvList.Items {
+		if _, ok := keep[dv.Name]; ok || dv.DeletionTimestamp != nil {
+			continue
+		}
+		if err := client.Kubevirt.CdiClient().CdiV1alpha1().DataVolumes(dv.Namespace).Delete(context.Background(), dv.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		klog.Infof("deleted datavolume %s/%s", dv.Namespace, dv.Name)
+	}
+	return nil
+}
+
+// deleteVM deletes a VirtualMachine so that it doesn't restart its
+// VirtualMachineInstance once that is deleted.
+func deleteVM(client *k8s.Client, vm *kubevirtV1.VirtualMachine) error {
+	if err := client.Kubevirt.VirtualMachine(vm.Namespace).Delete(vm.Name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	klog.Infof("deleted vm %s/%s", vm.Namespace, vm.Name)
+	return nil
+}
+
+func deleteVMIs(client *k8s.Client, cl *cluster.Cluster, vmis []kubevirtV1.VirtualMachineInstance) error {
+	if len(vmis) == 0 {
+		return nil
+	}
+	selector := fmt.Sprintf("cluster=%s", cl.Name)
+	var uids = make(map[string]struct{})
+	for _, vmi := range vmis {
+		if err := client.Kubevirt.VirtualMachineInstance(cl.Namespace).Delete(vmi.Name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
 		}
+		uids[string(vmi.UID)] = struct{}{}
+		klog.Infof("deleted vmi %s/%s", vmi.Namespace, vmi.Name)
 	}
-	if readyCount != len(k.VirtualMachineInstances) {
-		readyCount = 0
-		watch, err := client.K8S.CoreV1().Pods(cl.Namespace).Watch(context.Background(), metav1.ListOptions{
-			LabelSelector: fmt.Sprintf("cluster=%s", cl.Name),
+	// the pods are listed again on every poll, a pod stuck in Terminating
+	// fails the wait instead of blocking it
+	klog.Infof("waiting for the virt-launcher pods of %d vmis to terminate", len(vmis))
+	var pods []string
+	err := wait.PollImmediate(terminationInterval, terminationTimeout, func() (bool, error) {
+		podList, err := client.K8S.CoreV1().Pods(cl.Namespace).List(context.Background(), metav1.ListOptions{
+			LabelSelector: selector,
 		})
 		if err != nil {
-			return nil, err
+			return false, err
 		}
-		var done = make(chan bool)
-		go func() {
-			for event := range watch.ResultChan() {
-				p, ok := event.Object.(*v1.Pod)
-				if !ok {
-					klog.Fatal("unexpected type")
-				}
-				/*
-					klog.Infof("Type: %v\n", event.Type)
-					klog.Infof("Status: %v\n", p.Status.ContainerStatuses)
-					klog.Infof("Phase: %v\n", p.Status.Phase)
-					klog.Infof("podname %s\n", p.Name)
-					klog.Infof("ready %d, instances %d", readyCount, len(k.VirtualMachineInstances))
-				*/
-				if p.Status.Phase == "Running" {
-					readyCount++
-				}
-				if readyCount == len(k.VirtualMachineInstances) {
-					done <- true
-				}
+		pods = nil
+		for _, pod := range podList.Items {
+			if _, ok := uids[pod.Labels[kubevirtV1.CreatedByLabel]]; ok {
+				pods = append(pods, pod.Name)
+			}
+		}
+		return len(pods) == 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		sort.Strings(pods)
+		return fmt.Errorf("virt-launcher pods not terminated after %s: %s", terminationTimeout, strings.Join(pods, ", "))
+	}
+	return err
+}
 
+// Watch waits until every VirtualMachineInstance of the cluster is ready
+// and returns the networks of their virt-launcher pods. A node is ready once
+// its Ready condition is true and, unless skipped, the guest agent is
+// connected.
+func (k *KubevirtCluster) Watch(client *k8s.Client, cl *cluster.Cluster) (map[string]inventory.InstanceIPRole, error) {
+	timeout := cl.ReadinessTimeout()
+	var instanceMap map[string]inventory.InstanceIPRole
+	var pending = make(map[string]string)
+	var ready = make(map[string]struct{})
+	err := wait.PollImmediate(readinessInterval, timeout, func() (bool, error) {
+		var err error
+		instanceMap, pending, err = k.Ready(client, cl)
+		if err != nil {
+			return false, err
+		}
+		for _, vmi := range k.VirtualMachineInstances {
+			if _, ok := pending[vmi.Name]; ok {
+				continue
+			}
+			if _, ok := ready[vmi.Name]; !ok {
+				klog.Infof("node %s is ready", vmi.Name)
+				ready[vmi.Name] = struct{}{}
 			}
-		}()
-		<-done
+		}
+		return len(pending) == 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		var notReady []string
+		for name, reason := range pending {
+			notReady = append(notReady, fmt.Sprintf("%s (%s)", name, reason))
+		}
+		sort.Strings(notReady)
+		return nil, fmt.Errorf("nodes not ready after %s: %s", timeout, strings.Join(notReady, ", "))
+	} else if err != nil {
+		return nil, err
 	}
-	newPodList, err := client.K8S.CoreV1().Pods(cl.Namespace).List(context.Background(), metav1.ListOptions{
+	return instanceMap, nil
+}
+
+// Ready checks the readiness of all nodes once. If all nodes are ready it
+// returns their instance map, otherwise the reasons of the pending nodes.
+// Failed bare VirtualMachineInstances are returned as error, as they are
+// never restarted.
+func (k *KubevirtCluster) Ready(client *k8s.Client, cl *cluster.Cluster) (map[string]inventory.InstanceIPRole, map[string]string, error) {
+	var pending = make(map[string]string)
+	for _, vmi := range k.VirtualMachineInstances {
+		pending[vmi.Name] = "not created"
+	}
+	vmiList, err := client.Kubevirt.VirtualMachineInstance(cl.Namespace).List(&metav1.ListOptions{
 		LabelSelector: fmt.Sprintf("cluster=%s", cl.Name),
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	var readyVMIs = make(map[string]*kubevirtV1.VirtualMachineInstance)
+	for idx := range vmiList.Items {
+		vmi := &vmiList.Items[idx]
+		if _, ok := pending[vmi.Name]; !ok {
+			continue
+		}
+		if vmi.Status.Phase == kubevirtV1.Failed && len(k.VirtualMachines) == 0 {
+			return nil, nil, fmt.Errorf("node %s failed", vmi.Name)
+		}
+		if reason := notReadyReason(vmi, cl.Readiness.Skipguestagent); reason != "" {
+			pending[vmi.Name] = reason
+			continue
+		}
+		delete(pending, vmi.Name)
+		readyVMIs[vmi.Name] = vmi
+	}
+	if len(pending) > 0 {
+		return nil, pending, nil
+	}
+	podList, err := client.K8S.CoreV1().Pods(cl.Namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("cluster=%s", cl.Name),
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 	var instanceMap = make(map[string]inventory.InstanceIPRole)
-	for _, pod := range newPodList.Items {
-		var networkAnnotationList []roles.NetworkAnnotation
-		networkAnnotationString, ok := pod.Annotations["k8s.v1.cni.cncf.io/network-status"]
-		if !ok {
-			return nil, fmt.Errorf("no network annotation")
+	for name, vmi := range readyVMIs {
+		pod := launcherPod(podList.Items, vmi)
+		if pod == nil {
+			return nil, nil, fmt.Errorf("no virt-launcher pod found for node %s", name)
 		}
-		if err := json.Unmarshal([]byte(networkAnnotationString), &networkAnnotationList); err != nil {
-			return nil, err
+		networkAnnotationList, err := networkStatus(pod)
+		if err != nil {
+			return nil, nil, fmt.Errorf("node %s: %s", name, err)
 		}
-		instanceMap[pod.Spec.Hostname] = inventory.InstanceIPRole{
-			Role:     roles.Role(pod.Labels["role"]),
+		instanceMap[name] = inventory.InstanceIPRole{
+			Role:     roles.Role(vmi.Labels["role"]),
 			Networks: networkAnnotationList,
 		}
 	}
+	return instanceMap, pending, nil
+}
 
-	return instanceMap, nil
+const readinessInterval = 5 * time.Second
+
+const (
+	terminationInterval = 2 * time.Second
+	terminationTimeout  = 5 * time.Minute
+)
+
+// notReadyReason returns why vmi is not ready yet, or an empty string if it
+// is ready.
+func notReadyReason(vmi *kubevirtV1.VirtualMachineInstance, skipGuestAgent bool) string {
+	if !vmiReady(vmi) {
+		return fmt.Sprintf("phase %s", vmi.Status.Phase)
+	}
+	if !skipGuestAgent && !vmiAgentConnected(vmi) {
+		return "guest agent not connected"
+	}
+	return ""
+}
+
+// networkStatus parses the multus network-status annotation of a
+// virt-launcher pod.
+func networkStatus(pod *v1.Pod) ([]roles.NetworkAnnotation, error) {
+	var networkAnnotationList []roles.NetworkAnnotation
+	networkAnnotationString, ok := pod.Annotations["k8s.v1.cni.cncf.io/network-status"]
+	if !ok {
+		return nil, fmt.Errorf("no network annotation")
+	}
+	if err := json.Unmarshal([]byte(networkAnnotationString), &networkAnnotationList); err != nil {
+		return nil, err
+	}
+	return networkAnnotationList, nil
 }
 
 func NewKubevirtCluster(cl *cluster.Cluster) (*KubevirtCluster, error) {
 	kvCluster := &KubevirtCluster{}
-	expandedKeypath, err := hd.Expand(cl.Keypath)
+	pubKey, err := cl.PublicKey()
 	if err != nil {
 		return nil, err
 	}
-	pubKey, err := ioutil.ReadFile(expandedKeypath)
+	addresses, err := networkAddresses(cl)
 	if err != nil {
 		return nil, err
 	}
-	for c := 0; c < cl.Controller; c++ {
-		ci, err := cloudinit.CreateCloudInit(fmt.Sprintf("%s-%d", roles.Controller, c), string(pubKey))
-		if err != nil {
-			return nil, err
-		}
-		kvCluster.VirtualMachineInstances = append(kvCluster.VirtualMachineInstances, defineVMI(cl, ci, c, roles.Controller))
-	}
-	for c := 0; c < cl.Worker; c++ {
-		ci, err := cloudinit.CreateCloudInit(fmt.Sprintf("%s-%d", roles.Worker, c), string(pubKey))
-		if err != nil {
-			return nil, err
+	for _, pool := range cl.NodePools() {
+		for c := 0; c < pool.Count; c++ {
+			name := cluster.NodeName(pool, c)
+			ci, err := cloudinit.CreateCloudInit(name, pubKey, cl.Cloudinit)
+			if err != nil {
+				return nil, err
+			}
+			networks := nodeNetworks(cl, name, addresses)
+			nd, err := cloudinit.CreateNetworkData(networkInterfaces(networks))
+			if err != nil {
+				return nil, err
+			}
+			vmi, err := defineVMI(cl, pool, ci, nd, networks, name)
+			if err != nil {
+				return nil, err
+			}
+			kvCluster.VirtualMachineInstances = append(kvCluster.VirtualMachineInstances, vmi)
+			var dv *cdiv1.DataVolume
+			if pool.Disk.Mode == cluster.DataVolume {
+				dv, err = defineDataVolume(pool, vmi)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if cl.Vmi {
+				if dv != nil {
+					kvCluster.DataVolumes = append(kvCluster.DataVolumes, dv)
+				}
+				continue
+			}
+			vm := defineVM(cl, vmi)
+			if dv != nil {
+				vm.Spec.DataVolumeTemplates = []kubevirtV1.DataVolumeTemplateSpec{{
+					ObjectMeta: dv.ObjectMeta,
+					Spec:       dv.Spec,
+				}}
+			}
+			kvCluster.VirtualMachines = append(kvCluster.VirtualMachines, vm)
 		}
-		kvCluster.VirtualMachineInstances = append(kvCluster.VirtualMachineInstances, defineVMI(cl, ci, c, roles.Worker))
 	}
 	/*
 		clByte, err := yaml.Marshal(kvCluster)
@@ -155,46 +473,72 @@ func NewKubevirtCluster(cl *cluster.Cluster) (*KubevirtCluster, error) {
 	return kvCluster, nil
 }
 
-func defineVMI(cl *cluster.Cluster, ci string, idx int, role roles.Role) *kubevirtV1.VirtualMachineInstance {
+func defineVM(cl *cluster.Cluster, vmi *kubevirtV1.VirtualMachineInstance) *kubevirtV1.VirtualMachine {
+	runStrategy := kubevirtV1.RunStrategyAlways
+	if cl.Runstrategy != "" {
+		runStrategy = kubevirtV1.VirtualMachineRunStrategy(cl.Runstrategy)
+	}
+	return &kubevirtV1.VirtualMachine{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: kubevirtV1.GroupVersion.String(),
+			Kind:       kubevirtV1.VirtualMachineGroupVersionKind.Kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      vmi.Name,
+			Namespace: vmi.Namespace,
+			Labels:    vmi.Labels,
+		},
+		Spec: kubevirtV1.VirtualMachineSpec{
+			RunStrategy: &runStrategy,
+			Template: &kubevirtV1.VirtualMachineInstanceTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      vmi.Labels,
+					Annotations: vmi.Annotations,
+				},
+				Spec: vmi.Spec,
+			},
+		},
+	}
+}
+
+func defineVMI(cl *cluster.Cluster, pool cluster.NodePool, ci, nd string, networks []nodeNetwork, name string) (*kubevirtV1.VirtualMachineInstance, error) {
+	var labels = make(map[string]string)
+	for k, v := range pool.Labels {
+		labels[k] = v
+	}
+	labels["cluster"] = cl.Name
+	labels["role"] = string(pool.Role)
+	labels["pool"] = pool.Name
+	vmiNetworks, vmiInterfaces := defineNetworks(networks)
+	memory, err := resource.ParseQuantity(pool.Memory)
+	if err != nil {
+		return nil, fmt.Errorf("node pool %s: invalid memory %q: %s", pool.Name, pool.Memory, err)
+	}
+	cpu, err := resource.ParseQuantity(pool.Cpu)
+	if err != nil {
+		return nil, fmt.Errorf("node pool %s: invalid cpu %q: %s", pool.Name, pool.Cpu, err)
+	}
 	return &kubevirtV1.VirtualMachineInstance{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: kubevirtV1.GroupVersion.String(),
+			Kind:       kubevirtV1.VirtualMachineInstanceGroupVersionKind.Kind,
+		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s-%d", role, idx),
+			Name:      name,
 			Namespace: cl.Namespace,
-			Labels:    map[string]string{"cluster": cl.Name, "role": string(role)},
+			Labels:    labels,
 		},
 		Spec: kubevirtV1.VirtualMachineInstanceSpec{
-			Networks: []kubevirtV1.Network{{
-				Name: "default",
-				NetworkSource: kubevirtV1.NetworkSource{
-					Pod: &kubevirtV1.PodNetwork{},
-				},
-			}, {
-				Name: cl.Name,
-				NetworkSource: kubevirtV1.NetworkSource{
-					Multus: &kubevirtV1.MultusNetwork{
-						NetworkName: fmt.Sprintf("%s/%s", cl.Namespace, cl.Name),
-					},
-				},
-			}},
+			Networks: vmiNetworks,
 			Domain: kubevirtV1.DomainSpec{
 				Resources: kubevirtV1.ResourceRequirements{
 					Requests: v1.ResourceList{
-						"memory": resource.MustParse(cl.Memory),
-						"cpu":    resource.MustParse(cl.Cpu),
+						"memory": memory,
+						"cpu":    cpu,
 					},
 				},
 				Devices: kubevirtV1.Devices{
-					Interfaces: []kubevirtV1.Interface{{
-						Name: "default",
-						InterfaceBindingMethod: kubevirtV1.InterfaceBindingMethod{
-							Bridge: &kubevirtV1.InterfaceBridge{},
-						},
-					}, {
-						Name: cl.Name,
-						InterfaceBindingMethod: kubevirtV1.InterfaceBindingMethod{
-							Bridge: &kubevirtV1.InterfaceBridge{},
-						},
-					}},
+					Interfaces: vmiInterfaces,
 					Disks: []kubevirtV1.Disk{{
 						Name: fmt.Sprintf("%s-disk", cl.Name),
 						DiskDevice: kubevirtV1.DiskDevice{
@@ -213,22 +557,89 @@ func defineVMI(cl *cluster.Cluster, ci string, idx int, role roles.Role) *kubevi
 				},
 			},
 			Volumes: []kubevirtV1.Volume{{
-				Name: fmt.Sprintf("%s-disk", cl.Name),
-				VolumeSource: kubevirtV1.VolumeSource{
-					ContainerDisk: &kubevirtV1.ContainerDiskSource{
-						Image:           cl.Image,
-						ImagePullPolicy: "Always",
-					},
-				},
+				Name:         fmt.Sprintf("%s-disk", cl.Name),
+				VolumeSource: rootVolumeSource(pool, name),
 			}, {
 				Name: "cloudinitdisk",
 				VolumeSource: kubevirtV1.VolumeSource{
 					CloudInitNoCloud: &kubevirtV1.CloudInitNoCloudSource{
-						UserData: ci,
+						UserData:    ci,
+						NetworkData: nd,
 					},
 				},
 			}},
 		},
+	}, nil
+}
+
+func rootVolumeSource(pool cluster.NodePool, name string) kubevirtV1.VolumeSource {
+	if pool.Disk.Mode == cluster.DataVolume {
+		return kubevirtV1.VolumeSource{
+			DataVolume: &kubevirtV1.DataVolumeSource{
+				Name: dataVolumeName(name),
+			},
+		}
+	}
+	return kubevirtV1.VolumeSource{
+		ContainerDisk: &kubevirtV1.ContainerDiskSource{
+			Image:           pool.Image,
+			ImagePullPolicy: "Always",
+		},
 	}
+}
+
+func dataVolumeName(name string) string {
+	return fmt.Sprintf("%s-disk", name)
+}
 
+func defineDataVolume(pool cluster.NodePool, vmi *kubevirtV1.VirtualMachineInstance) (*cdiv1.DataVolume, error) {
+	size := pool.Disk.Size
+	if size == "" {
+		size = "20Gi"
+	}
+	storage, err := resource.ParseQuantity(size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid disk size %s: %s", size, err)
+	}
+	var source cdiv1.DataVolumeSource
+	if pool.Disk.Sourcepvc != "" {
+		pvc := strings.SplitN(pool.Disk.Sourcepvc, "/", 2)
+		if len(pvc) != 2 {
+			return nil, fmt.Errorf("sourcepvc %s is not in namespace/name format", pool.Disk.Sourcepvc)
+		}
+		source.PVC = &cdiv1.DataVolumeSourcePVC{
+			Namespace: pvc[0],
+			Name:      pvc[1],
+		}
+	} else {
+		source.Registry = &cdiv1.DataVolumeSourceRegistry{
+			URL: fmt.Sprintf("docker://%s", pool.Image),
+		}
+	}
+	dv := &cdiv1.DataVolume{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: cdiv1.SchemeGroupVersion.String(),
+			Kind:       "DataVolume",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dataVolumeName(vmi.Name),
+			Namespace: vmi.Namespace,
+			Labels:    vmi.Labels,
+		},
+		Spec: cdiv1.DataVolumeSpec{
+			Source: source,
+			PVC: &v1.PersistentVolumeClaimSpec{
+				AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{
+						v1.ResourceStorage: storage,
+					},
+				},
+			},
+		},
+	}
+	if pool.Disk.Storageclass != "" {
+		dv.Spec.PVC.StorageClassName = &pool.Disk.Storageclass
+	}
+	return dv, nil
 }
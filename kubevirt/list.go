@@ -0,0 +1,137 @@
+package kubevirt
+
+import (
+	"context"
+	"sort"
+
+	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	"github.com/michaelhenkel/cn2kubevirt/roles"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubevirtV1 "kubevirt.io/client-go/api/v1"
+)
+
+type ClusterSummary struct {
+	Name       string      `json:"name" yaml:"name"`
+	Namespace  string      `json:"namespace" yaml:"namespace"`
+	Controller int         `json:"controller" yaml:"controller"`
+	Worker     int         `json:"worker" yaml:"worker"`
+	Ready      int         `json:"ready" yaml:"ready"`
+	Cpu        string      `json:"cpu" yaml:"cpu"`
+	Memory     string      `json:"memory" yaml:"memory"`
+	ServiceIP  string      `json:"serviceIP" yaml:"serviceIP"`
+	Created    metav1.Time `json:"created" yaml:"created"`
+}
+
+// List discovers all clusters on the host cluster by the cluster label
+// set on the VirtualMachines, VirtualMachineInstances and the API service.
+func List(client *k8s.Client) ([]ClusterSummary, error) {
+	vmiList, err := client.Kubevirt.VirtualMachineInstance(metav1.NamespaceAll).List(&metav1.ListOptions{
+		LabelSelector: "cluster",
+	})
+	if err != nil {
+		return nil, err
+	}
+	vmList, err := client.Kubevirt.VirtualMachine(metav1.NamespaceAll).List(&metav1.ListOptions{
+		LabelSelector: "cluster",
+	})
+	if err != nil {
+		return nil, err
+	}
+	svcList, err := client.K8S.CoreV1().Services(metav1.NamespaceAll).List(context.Background(), metav1.ListOptions{
+		LabelSelector: "cluster",
+	})
+	if err != nil {
+		return nil, err
+	}
+	var summaryMap = make(map[string]*ClusterSummary)
+	var cpuMap = make(map[string]*resource.Quantity)
+	var memoryMap = make(map[string]*resource.Quantity)
+	getSummary := func(obj metav1.ObjectMeta) *ClusterSummary {
+		key := obj.Namespace + "/" + obj.Labels["cluster"]
+		summary, ok := summaryMap[key]
+		if !ok {
+			summary = &ClusterSummary{
+				Name:      obj.Labels["cluster"],
+				Namespace: obj.Namespace,
+				Created:   obj.CreationTimestamp,
+			}
+			summaryMap[key] = summary
+			cpuMap[key] = resource.NewQuantity(0, resource.DecimalSI)
+			memoryMap[key] = resource.NewQuantity(0, resource.BinarySI)
+		}
+		if obj.CreationTimestamp.Before(&summary.Created) {
+			summary.Created = obj.CreationTimestamp
+		}
+		return summary
+	}
+	addNode := func(obj metav1.ObjectMeta, spec *kubevirtV1.VirtualMachineInstanceSpec) *ClusterSummary {
+		summary := getSummary(obj)
+		switch roles.Role(obj.Labels["role"]) {
+		case roles.Controller:
+			summary.Controller++
+		case roles.Worker:
+			summary.Worker++
+		}
+		key := obj.Namespace + "/" + obj.Labels["cluster"]
+		if cpu, ok := spec.Domain.Resources.Requests[v1.ResourceCPU]; ok {
+			cpuMap[key].Add(cpu)
+		}
+		if memory, ok := spec.Domain.Resources.Requests[v1.ResourceMemory]; ok {
+			memoryMap[key].Add(memory)
+		}
+		return summary
+	}
+	var vmis = make(map[string]struct{})
+	for _, vmi := range vmiList.Items {
+		vmis[vmi.Namespace+"/"+vmi.Name] = struct{}{}
+		summary := addNode(vmi.ObjectMeta, &vmi.Spec)
+		if vmiReady(&vmi) {
+			summary.Ready++
+		}
+	}
+	// stopped VirtualMachines have no VirtualMachineInstance but are still
+	// part of the cluster.
+	for _, vm := range vmList.Items {
+		if _, ok := vmis[vm.Namespace+"/"+vm.Name]; ok || vm.Spec.Template == nil {
+			continue
+		}
+		addNode(vm.ObjectMeta, &vm.Spec.Template.Spec)
+	}
+	for _, svc := range svcList.Items {
+		summary := getSummary(svc.ObjectMeta)
+		summary.ServiceIP = svc.Spec.ClusterIP
+	}
+	var summaryList []ClusterSummary
+	for key, summary := range summaryMap {
+		summary.Cpu = cpuMap[key].String()
+		summary.Memory = memoryMap[key].String()
+		summaryList = append(summaryList, *summary)
+	}
+	sort.Slice(summaryList, func(i, j int) bool {
+		if summaryList[i].Namespace != summaryList[j].Namespace {
+			return summaryList[i].Namespace < summaryList[j].Namespace
+		}
+		return summaryList[i].Name < summaryList[j].Name
+	})
+	return summaryList, nil
+}
+
+func vmiReady(vmi *kubevirtV1.VirtualMachineInstance) bool {
+	for _, condition := range vmi.Status.Conditions {
+		if condition.Type == kubevirtV1.VirtualMachineInstanceReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func vmiAgentConnected(vmi *kubevirtV1.VirtualMachineInstance) bool {
+	for _, condition := range vmi.Status.Conditions {
+		if condition.Type == kubevirtV1.VirtualMachineInstanceAgentConnected {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package kubevirt
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/michaelhenkel/cn2kubevirt/cloudinit"
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	kubevirtV1 "kubevirt.io/client-go/api/v1"
+)
+
+const podNetworkName = "default"
+
+// nodeNetwork is a NIC of a node attached to the pod network or to a
+// NetworkAttachmentDefinition.
+type nodeNetwork struct {
+	cloudinit.Interface
+	// nad is the namespace/name of the NetworkAttachmentDefinition, empty
+	// for the pod network.
+	nad string
+}
+
+// nodeNetworks returns the NICs of a node. addresses holds the static node
+// addresses per network. A NIC with a static address is attached to the
+// NetworkAttachmentDefinition of the node.
+func nodeNetworks(cl *cluster.Cluster, node string, addresses map[string]map[string]string) []nodeNetwork {
+	networks := []nodeNetwork{{
+		Interface: cloudinit.Interface{
+			Name:       podNetworkName,
+			Macaddress: macAddress(cl, node, podNetworkName),
+			Config:     cl.Interfaces.Pod,
+		},
+	}, {
+		Interface: cloudinit.Interface{
+			Name:       cl.Name,
+			Macaddress: macAddress(cl, node, cl.Name),
+			Address:    addresses[cl.Name][node],
+			Config:     cl.Interfaces.Cluster,
+		},
+		nad: nodeNetworkAttachmentDefinition(cl, cl.Name, addresses[cl.Name][node], node),
+	}}
+	for _, network := range cl.Networks {
+		networks = append(networks, nodeNetwork{
+			Interface: cloudinit.Interface{
+				Name:       network.Name,
+				Macaddress: macAddress(cl, node, network.Name),
+				Address:    addresses[network.Name][node],
+				Config:     network.Interface,
+			},
+			nad: nodeNetworkAttachmentDefinition(cl, NetworkAttachmentDefinitionName(cl, network), addresses[network.Name][node], node),
+		})
+	}
+	return networks
+}
+
+// nodeNetworkAttachmentDefinition returns the namespace/name of the
+// NetworkAttachmentDefinition a NIC of node is attached to.
+func nodeNetworkAttachmentDefinition(cl *cluster.Cluster, name, address, node string) string {
+	if address != "" {
+		name = nodeNetworkAttachmentDefinitionName(name, node)
+	}
+	return fmt.Sprintf("%s/%s", cl.Namespace, name)
+}
+
+// networkAddresses returns the static node addresses of the cluster and
+// the secondary networks, keyed by network name.
+func networkAddresses(cl *cluster.Cluster) (map[string]map[string]string, error) {
+	var addresses = make(map[string]map[string]string)
+	clusterAddresses, err := cl.NodeAddresses()
+	if err != nil {
+		return nil, err
+	}
+	addresses[cl.Name] = clusterAddresses
+	for _, network := range cl.Networks {
+		networkAddresses, err := cl.NetworkAddresses(network)
+		if err != nil {
+			return nil, fmt.Errorf("network %s: %s", network.Name, err)
+		}
+		addresses[network.Name] = networkAddresses
+	}
+	return addresses, nil
+}
+
+// macAddress derives a stable, locally administered MAC address for the
+// NIC of a node, so the guest can match it in the network data.
+func macAddress(cl *cluster.Cluster, node, network string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{cl.Namespace, cl.Name, node, network}, "/")))
+	return fmt.Sprintf("02:%02x:%02x:%02x:%02x:%02x", sum[0], sum[1], sum[2], sum[3], sum[4])
+}
+
+func networkInterfaces(networks []nodeNetwork) []cloudinit.Interface {
+	var interfaces []cloudinit.Interface
+	for _, network := range networks {
+		interfaces = append(interfaces, network.Interface)
+	}
+	return interfaces
+}
+
+// defineNetworks returns the networks and bridged interfaces of a VMI.
+func defineNetworks(networks []nodeNetwork) ([]kubevirtV1.Network, []kubevirtV1.Interface) {
+	var vmiNetworks []kubevirtV1.Network
+	var vmiInterfaces []kubevirtV1.Interface
+	for _, network := range networks {
+		vmiNetwork := kubevirtV1.Network{
+			Name: network.Name,
+		}
+		if network.nad == "" {
+			vmiNetwork.Pod = &kubevirtV1.PodNetwork{}
+		} else {
+			vmiNetwork.Multus = &kubevirtV1.MultusNetwork{
+				NetworkName: network.nad,
+			}
+		}
+		vmiNetworks = append(vmiNetworks, vmiNetwork)
+		vmiInterfaces = append(vmiInterfaces, kubevirtV1.Interface{
+			Name:       network.Name,
+			MacAddress: network.Macaddress,
+			InterfaceBindingMethod: kubevirtV1.InterfaceBindingMethod{
+				Bridge: &kubevirtV1.InterfaceBridge{},
+			},
+		})
+	}
+	return vmiNetworks, vmiInterfaces
+}
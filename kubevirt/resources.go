@@ -0,0 +1,294 @@
+package kubevirt
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	nadv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"github.com/michaelhenkel/cn2kubevirt/cni"
+	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	"github.com/michaelhenkel/cn2kubevirt/roles"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/klog"
+)
+
+func DefineNamespace(cl *cluster.Cluster) *v1.Namespace {
+	return &v1.Namespace{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Namespace",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: cl.Namespace,
+		},
+	}
+}
+
+// DefineNetworkAttachmentDefinitions defines the NetworkAttachmentDefinitions
+// of the cluster network and all secondary networks with the configured CNI
+// provider.
+func DefineNetworkAttachmentDefinitions(cl *cluster.Cluster) ([]*nadv1.NetworkAttachmentDefinition, error) {
+	provider, err := cni.NewProvider(cl.Cni)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := cl.NodeAddresses()
+	if err != nil {
+		return nil, err
+	}
+	nads, err := defineNetworkAttachmentDefinitions(provider, cni.Network{
+		Namespace: cl.Namespace,
+		Name:      cl.Name,
+		Subnet:    cl.Subnet,
+		Addresses: addresses,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, network := range cl.Networks {
+		addresses, err := cl.NetworkAddresses(network)
+		if err != nil {
+			return nil, fmt.Errorf("network %s: %s", network.Name, err)
+		}
+		networkNads, err := defineNetworkAttachmentDefinitions(provider, cni.Network{
+			Namespace: cl.Namespace,
+			Name:      NetworkAttachmentDefinitionName(cl, network),
+			Subnet:    network.Subnet,
+			Addresses: addresses,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("network %s: %s", network.Name, err)
+		}
+		nads = append(nads, networkNads...)
+	}
+	// the label finds the NetworkAttachmentDefinitions on deletion even if
+	// the spec changed or became invalid
+	for _, nad := range nads {
+		nad.Labels = map[string]string{"cluster": cl.Name}
+	}
+	return nads, nil
+}
+
+// defineNetworkAttachmentDefinitions defines the shared
+// NetworkAttachmentDefinition of a network and one per node with a static
+// address.
+func defineNetworkAttachmentDefinitions(provider cni.Provider, network cni.Network) ([]*nadv1.NetworkAttachmentDefinition, error) {
+	nad, err := provider.NetworkAttachmentDefinition(network)
+	if err != nil {
+		return nil, err
+	}
+	nads := []*nadv1.NetworkAttachmentDefinition{nad}
+	var nodes []string
+	for node := range network.Addresses {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		nad, err := provider.NetworkAttachmentDefinition(cni.Network{
+			Namespace: network.Namespace,
+			Name:      nodeNetworkAttachmentDefinitionName(network.Name, node),
+			Subnet:    network.Subnet,
+			Address:   network.Addresses[node],
+		})
+		if err != nil {
+			return nil, err
+		}
+		nads = append(nads, nad)
+	}
+	return nads, nil
+}
+
+// NetworkAttachmentDefinitionName returns the name of the
+// NetworkAttachmentDefinition of a secondary network.
+func NetworkAttachmentDefinitionName(cl *cluster.Cluster, network cluster.Network) string {
+	return fmt.Sprintf("%s-%s", cl.Name, network.Name)
+}
+
+// nodeNetworkAttachmentDefinitionName returns the name of the
+// NetworkAttachmentDefinition assigning the static address of a node. The
+// dot keeps it apart from the names of the secondary networks.
+func nodeNetworkAttachmentDefinitionName(name, node string) string {
+	return fmt.Sprintf("%s.%s", name, node)
+}
+
+// DefineService defines the service load balancing the API servers of the
+// controllers. It is a NodePort or LoadBalancer service if the cluster is
+// exposed that way.
+func DefineService(cl *cluster.Cluster) *v1.Service {
+	svc := &v1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cl.Name,
+			Namespace: cl.Namespace,
+			Labels:    map[string]string{"cluster": cl.Name},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{
+				Name: "api",
+				Port: 6443,
+				TargetPort: intstr.IntOrString{
+					IntVal: 6443,
+				},
+				Protocol: v1.ProtocolTCP,
+			}},
+			Selector: map[string]string{
+				"cluster": cl.Name,
+				"role":    string(roles.Controller),
+			},
+		},
+	}
+	switch cl.Expose.Type {
+	case cluster.ExposeNodePort:
+		svc.Spec.Type = v1.ServiceTypeNodePort
+		svc.Spec.Ports[0].NodePort = cl.Expose.Nodeport
+		svc.Annotations = cl.Expose.Annotations
+	case cluster.ExposeLoadBalancer:
+		svc.Spec.Type = v1.ServiceTypeLoadBalancer
+		svc.Spec.LoadBalancerIP = cl.Expose.Loadbalancerip
+		svc.Annotations = cl.Expose.Annotations
+	}
+	return svc
+}
+
+// CreateNetworks creates the namespace and the NetworkAttachmentDefinitions
+// of the cluster unless they exist.
+func CreateNetworks(client *k8s.Client, cl *cluster.Cluster) error {
+	_, err := client.K8S.CoreV1().Namespaces().Get(context.Background(), cl.Namespace, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.K8S.CoreV1().Namespaces().Create(context.Background(), DefineNamespace(cl), metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	nads, err := DefineNetworkAttachmentDefinitions(cl)
+	if err != nil {
+		return err
+	}
+	for _, nad := range nads {
+		_, err = client.Nad.K8sCniCncfIoV1().NetworkAttachmentDefinitions(cl.Namespace).Get(context.Background(), nad.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			_, err = client.Nad.K8sCniCncfIoV1().NetworkAttachmentDefinitions(cl.Namespace).Create(context.Background(), nad, metav1.CreateOptions{})
+			if err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateService creates the API service of the cluster and the Ingress or
+// Route exposing it, updates them if the exposure changed and returns the
+// service.
+func CreateService(client *k8s.Client, cl *cluster.Cluster) (*v1.Service, error) {
+	if err := createExposure(client, cl); err != nil {
+		return nil, err
+	}
+	svc, err := client.K8S.CoreV1().Services(cl.Namespace).Get(context.Background(), cl.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return client.K8S.CoreV1().Services(cl.Namespace).Create(context.Background(), DefineService(cl), metav1.CreateOptions{})
+	} else if err != nil {
+		return nil, err
+	}
+	if !updateService(svc, DefineService(cl)) {
+		return svc, nil
+	}
+	klog.Infof("updating service %s/%s to type %s", cl.Namespace, cl.Name, svc.Spec.Type)
+	return client.K8S.CoreV1().Services(cl.Namespace).Update(context.Background(), svc, metav1.UpdateOptions{})
+}
+
+// updateService copies the exposure of desired to svc and reports whether
+// svc changed. Annotations not set in desired are kept.
+func updateService(svc, desired *v1.Service) bool {
+	var changed bool
+	serviceType := desired.Spec.Type
+	if serviceType == "" {
+		serviceType = v1.ServiceTypeClusterIP
+	}
+	if svc.Spec.Type != serviceType {
+		svc.Spec.Type = serviceType
+		changed = true
+	}
+	for idx := range svc.Spec.Ports {
+		nodePort := svc.Spec.Ports[idx].NodePort
+		switch {
+		case serviceType == v1.ServiceTypeClusterIP && nodePort != 0:
+			// ClusterIP services must not have node ports
+			svc.Spec.Ports[idx].NodePort = 0
+			changed = true
+		case serviceType == v1.ServiceTypeNodePort && desired.Spec.Ports[0].NodePort != 0 && nodePort != desired.Spec.Ports[0].NodePort:
+			svc.Spec.Ports[idx].NodePort = desired.Spec.Ports[0].NodePort
+			changed = true
+		}
+	}
+	if svc.Spec.LoadBalancerIP != desired.Spec.LoadBalancerIP {
+		svc.Spec.LoadBalancerIP = desired.Spec.LoadBalancerIP
+		changed = true
+	}
+	if updateAnnotations(&svc.ObjectMeta, desired.Annotations) {
+		changed = true
+	}
+	return changed
+}
+
+// updateAnnotations sets annotations on meta and reports whether it changed.
+func updateAnnotations(meta *metav1.ObjectMeta, annotations map[string]string) bool {
+	var changed bool
+	for k, v := range annotations {
+		if current, ok := meta.Annotations[k]; ok && current == v {
+			continue
+		}
+		if meta.Annotations == nil {
+			meta.Annotations = make(map[string]string)
+		}
+		meta.Annotations[k] = v
+		changed = true
+	}
+	return changed
+}
+
+// DeleteResources deletes the API service, its Ingress or Route and the
+// NetworkAttachmentDefinitions of the cluster.
+func DeleteResources(client *k8s.Client, cl *cluster.Cluster) error {
+	err := client.K8S.CoreV1().Services(cl.Namespace).Delete(context.Background(), cl.Name, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	klog.Infof("deleted service %s/%s", cl.Namespace, cl.Name)
+	if err := deleteExposure(client, cl, ""); err != nil {
+		return err
+	}
+	nadList, err := client.Nad.K8sCniCncfIoV1().NetworkAttachmentDefinitions(cl.Namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("cluster=%s", cl.Name),
+	})
+	if err != nil {
+		return err
+	}
+	// the cluster network is also deleted by name, it was created without
+	// a label by earlier versions
+	names := map[string]struct{}{cl.Name: {}}
+	for _, nad := range nadList.Items {
+		names[nad.Name] = struct{}{}
+	}
+	for name := range names {
+		err = client.Nad.K8sCniCncfIoV1().NetworkAttachmentDefinitions(cl.Namespace).Delete(context.Background(), name, metav1.DeleteOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		klog.Infof("deleted network attachment definition %s/%s", cl.Namespace, name)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package kubevirt
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	"github.com/michaelhenkel/cn2kubevirt/roles"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubevirtV1 "kubevirt.io/client-go/api/v1"
+)
+
+type NodeStatus struct {
+	Name      string     `json:"name" yaml:"name"`
+	Role      roles.Role `json:"role" yaml:"role"`
+	Phase     string     `json:"phase" yaml:"phase"`
+	Pod       string     `json:"pod" yaml:"pod"`
+	Node      string     `json:"node" yaml:"node"`
+	PodIP     string     `json:"podIP" yaml:"podIP"`
+	ClusterIP string     `json:"clusterIP" yaml:"clusterIP"`
+}
+
+type ClusterStatus struct {
+	Name      string       `json:"name" yaml:"name"`
+	Namespace string       `json:"namespace" yaml:"namespace"`
+	ServiceIP string       `json:"serviceIP" yaml:"serviceIP"`
+	Nodes     []NodeStatus `json:"nodes" yaml:"nodes"`
+}
+
+// Status collects the state of every VirtualMachineInstance of the cluster
+// together with its virt-launcher pod and the API service ClusterIP.
+func (k *KubevirtCluster) Status(client *k8s.Client, cl *cluster.Cluster) (*ClusterStatus, error) {
+	status := &ClusterStatus{
+		Name:      cl.Name,
+		Namespace: cl.Namespace,
+	}
+	svc, err := client.K8S.CoreV1().Services(cl.Namespace).Get(context.Background(), cl.Name, metav1.GetOptions{})
+	if err == nil {
+		status.ServiceIP = svc.Spec.ClusterIP
+	} else if !errors.IsNotFound(err) {
+		return nil, err
+	}
+	podList, err := client.K8S.CoreV1().Pods(cl.Namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("cluster=%s", cl.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	multusNetwork := fmt.Sprintf("%s/%s", cl.Namespace, cl.Name)
+	for _, vmi := range k.VirtualMachineInstances {
+		nodeStatus := NodeStatus{
+			Name: vmi.Name,
+			Role: roles.Role(vmi.Labels["role"]),
+		}
+		currentVMI, err := client.Kubevirt.VirtualMachineInstance(vmi.Namespace).Get(vmi.Name, &metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			nodeStatus.Phase = "NotFound"
+			if len(k.VirtualMachines) > 0 {
+				vm, err := client.Kubevirt.VirtualMachine(vmi.Namespace).Get(vmi.Name, &metav1.GetOptions{})
+				if err == nil {
+					nodeStatus.Phase = string(vm.Status.PrintableStatus)
+				} else if !errors.IsNotFound(err) {
+					return nil, err
+				}
+			}
+			status.Nodes = append(status.Nodes, nodeStatus)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		nodeStatus.Phase = string(currentVMI.Status.Phase)
+		nodeStatus.Node = currentVMI.Status.NodeName
+		pod := launcherPod(podList.Items, currentVMI)
+		if pod != nil {
+			nodeStatus.Pod = pod.Name
+			if nodeStatus.Node == "" {
+				nodeStatus.Node = pod.Spec.NodeName
+			}
+			networks, err := networkStatus(pod)
+			if err == nil {
+				for _, nw := range networks {
+					if len(nw.Ips) == 0 {
+						continue
+					}
+					if nw.Name == multusNetwork {
+						nodeStatus.ClusterIP = nw.Ips[0]
+					} else if nw.Default {
+						nodeStatus.PodIP = nw.Ips[0]
+					}
+				}
+			}
+		}
+		status.Nodes = append(status.Nodes, nodeStatus)
+	}
+	return status, nil
+}
+
+// launcherPod returns the virt-launcher pod created for the vmi, preferring a
+// running pod over terminated ones left behind by earlier incarnations.
+func launcherPod(pods []v1.Pod, vmi *kubevirtV1.VirtualMachineInstance) *v1.Pod {
+	var found *v1.Pod
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Labels[kubevirtV1.CreatedByLabel] != string(vmi.UID) {
+			continue
+		}
+		if pod.Status.Phase == v1.PodRunning {
+			return pod
+		}
+		found = pod
+	}
+	return found
+}
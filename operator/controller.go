@@ -0,0 +1,252 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/michaelhenkel/cn2kubevirt/artifacts"
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"github.com/michaelhenkel/cn2kubevirt/inventory"
+	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	"github.com/michaelhenkel/cn2kubevirt/kubevirt"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+)
+
+// Controller reconciles all VirtualClusters of the host cluster. It polls
+// instead of watching, a reconcile never waits for nodes to become ready.
+type Controller struct {
+	client   *k8s.Client
+	workdir  string
+	interval time.Duration
+}
+
+// NewController creates a controller which keeps the inventory files of the
+// clusters below workdir and reconciles every interval.
+func NewController(client *k8s.Client, workdir string, interval time.Duration) *Controller {
+	return &Controller{
+		client:   client,
+		workdir:  workdir,
+		interval: interval,
+	}
+}
+
+// Run reconciles until stop is closed.
+func (c *Controller) Run(stop <-chan struct{}) {
+	wait.Until(c.reconcileAll, c.interval, stop)
+}
+
+func (c *Controller) reconcileAll() {
+	vcList, err := c.client.Dynamic.Resource(GroupVersionResource).Namespace(metav1.NamespaceAll).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		klog.Error(err)
+		return
+	}
+	for idx := range vcList.Items {
+		vc := &vcList.Items[idx]
+		if err := c.reconcile(vc); err != nil {
+			klog.Errorf("virtualcluster %s/%s: %s", vc.GetNamespace(), vc.GetName(), err)
+		}
+	}
+}
+
+func (c *Controller) reconcile(vc *unstructured.Unstructured) error {
+	cl, err := toCluster(vc, c.workdir)
+	if vc.GetDeletionTimestamp() != nil {
+		if err == nil {
+			err = cl.Validate()
+		}
+		if err != nil {
+			klog.Warningf("virtualcluster %s/%s: deleting by name, invalid spec: %s", vc.GetNamespace(), vc.GetName(), err)
+			cl = metadataCluster(vc, c.workdir)
+		}
+		return c.delete(vc, cl)
+	}
+	if err != nil {
+		return c.updateStatus(vc, VirtualClusterStatus{
+			Phase:              Failed,
+			Message:            err.Error(),
+			ObservedGeneration: vc.GetGeneration(),
+		})
+	}
+	if !hasFinalizer(vc) {
+		vc.SetFinalizers(append(vc.GetFinalizers(), finalizer))
+		vc, err = c.client.Dynamic.Resource(GroupVersionResource).Namespace(vc.GetNamespace()).Update(context.Background(), vc, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	if err := cl.Validate(); err != nil {
+		return c.updateStatus(vc, VirtualClusterStatus{
+			Phase:              Failed,
+			Message:            err.Error(),
+			ObservedGeneration: vc.GetGeneration(),
+		})
+	}
+	status, err := c.apply(vc, cl)
+	if err != nil {
+		status = &VirtualClusterStatus{
+			Phase:              Failed,
+			Message:            err.Error(),
+			ObservedGeneration: vc.GetGeneration(),
+		}
+	}
+	return c.updateStatus(vc, *status)
+}
+
+// apply creates the missing resources and nodes of the cluster, prunes
+// removed nodes and writes the inventory once all nodes are ready.
+func (c *Controller) apply(vc *unstructured.Unstructured, cl *cluster.Cluster) (*VirtualClusterStatus, error) {
+	if err := kubevirt.CreateNetworks(c.client, cl); err != nil {
+		return nil, err
+	}
+	kvc, err := kubevirt.NewKubevirtCluster(cl)
+	if err != nil {
+		return nil, err
+	}
+	pruned, err := kvc.Prune(c.client, cl)
+	if err != nil {
+		return nil, err
+	}
+	if len(pruned) > 0 {
+		klog.Infof("virtualcluster %s/%s: removed nodes %s", cl.Namespace, cl.Name, strings.Join(pruned, ", "))
+	}
+	created, err := kvc.Create(c.client.Kubevirt)
+	if err != nil {
+		return nil, err
+	}
+	if len(created) > 0 {
+		klog.Infof("virtualcluster %s/%s: created nodes %s", cl.Namespace, cl.Name, strings.Join(created, ", "))
+	}
+	svc, err := kubevirt.CreateService(c.client, cl)
+	if err != nil {
+		return nil, err
+	}
+	clusterStatus, err := kvc.Status(c.client, cl)
+	if err != nil {
+		return nil, err
+	}
+	externalEndpoint, err := kubevirt.ExternalEndpoint(c.client, cl, svc)
+	if err != nil {
+		return nil, err
+	}
+	status := &VirtualClusterStatus{
+		Phase:              Provisioning,
+		ObservedGeneration: vc.GetGeneration(),
+		ServiceIP:          svc.Spec.ClusterIP,
+		ExternalEndpoint:   externalEndpoint,
+		Nodes:              clusterStatus.Nodes,
+	}
+	instanceMap, pending, err := kvc.Ready(c.client, cl)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) > 0 {
+		var notReady []string
+		for name, reason := range pending {
+			notReady = append(notReady, fmt.Sprintf("%s (%s)", name, reason))
+		}
+		sort.Strings(notReady)
+		status.Message = fmt.Sprintf("waiting for nodes %s", strings.Join(notReady, ", "))
+		return status, nil
+	}
+	// the certificates must be valid for the external address, so the
+	// inventory waits for it
+	if cl.Expose.Type != "" && externalEndpoint == "" {
+		status.Message = fmt.Sprintf("waiting for the external address of service %s/%s", cl.Namespace, cl.Name)
+		return status, nil
+	}
+	current := currentStatus(vc)
+	if current.Phase != Ready || current.ObservedGeneration != vc.GetGeneration() || current.ServiceIP != status.ServiceIP || current.ExternalEndpoint != status.ExternalEndpoint {
+		if err := inventory.NewInventory(instanceMap, *cl, status.ServiceIP, status.ExternalEndpoint); err != nil {
+			return nil, err
+		}
+		if cl.Storeartifacts {
+			if err := artifacts.Store(c.client, cl); err != nil {
+				return nil, err
+			}
+		}
+	}
+	status.Phase = Ready
+	status.Message = fmt.Sprintf("inventory written to %s", cl.Kubeconfigdir)
+	return status, nil
+}
+
+// delete deletes the nodes, resources and files of the cluster and releases
+// the VirtualCluster. It doesn't wait for the virt-launcher pods, the
+// next reconcile checks again until they are gone.
+func (c *Controller) delete(vc *unstructured.Unstructured, cl *cluster.Cluster) error {
+	if !hasFinalizer(vc) {
+		return nil
+	}
+	pods, err := kubevirt.DeleteNodes(c.client, cl)
+	if err != nil {
+		return err
+	}
+	if len(pods) > 0 {
+		return c.updateStatus(vc, VirtualClusterStatus{
+			Phase:              Deleting,
+			Message:            fmt.Sprintf("waiting for virt-launcher pods %s", strings.Join(pods, ", ")),
+			ObservedGeneration: vc.GetGeneration(),
+		})
+	}
+	if err := kubevirt.DeleteResources(c.client, cl); err != nil {
+		return err
+	}
+	if err := artifacts.Delete(c.client, cl); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(cl.Kubeconfigdir); err != nil {
+		return err
+	}
+	var finalizers []string
+	for _, f := range vc.GetFinalizers() {
+		if f != finalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	vc.SetFinalizers(finalizers)
+	_, err = c.client.Dynamic.Resource(GroupVersionResource).Namespace(vc.GetNamespace()).Update(context.Background(), vc, metav1.UpdateOptions{})
+	return err
+}
+
+// updateStatus writes status unless it is unchanged.
+func (c *Controller) updateStatus(vc *unstructured.Unstructured, status VirtualClusterStatus) error {
+	newStatus, err := toUnstructuredStatus(status)
+	if err != nil {
+		return err
+	}
+	oldStatus, _, _ := unstructured.NestedMap(vc.Object, "status")
+	if equality.Semantic.DeepEqual(oldStatus, newStatus) {
+		return nil
+	}
+	if status.Phase != Phase(fmt.Sprint(oldStatus["phase"])) {
+		klog.Infof("virtualcluster %s/%s: %s %s", vc.GetNamespace(), vc.GetName(), status.Phase, status.Message)
+	}
+	if err := unstructured.SetNestedMap(vc.Object, newStatus, "status"); err != nil {
+		return err
+	}
+	updated, err := c.client.Dynamic.Resource(GroupVersionResource).Namespace(vc.GetNamespace()).UpdateStatus(context.Background(), vc, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	vc.Object = updated.Object
+	return nil
+}
+
+func currentStatus(vc *unstructured.Unstructured) VirtualClusterStatus {
+	var status VirtualClusterStatus
+	phase, _, _ := unstructured.NestedString(vc.Object, "status", "phase")
+	status.Phase = Phase(phase)
+	status.ObservedGeneration, _, _ = unstructured.NestedInt64(vc.Object, "status", "observedGeneration")
+	status.ServiceIP, _, _ = unstructured.NestedString(vc.Object, "status", "serviceIP")
+	status.ExternalEndpoint, _, _ = unstructured.NestedString(vc.Object, "status", "externalEndpoint")
+	return status
+}
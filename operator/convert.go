@@ -0,0 +1,145 @@
+package operator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/json"
+)
+
+// NewVirtualCluster converts a cluster file into a VirtualCluster named
+// after the cluster in the cluster namespace. The spec keeps the keys of
+// the cluster file, except for keypath which is replaced by the key itself
+// because the operator can't read local files.
+func NewVirtualCluster(cl *cluster.Cluster) (*unstructured.Unstructured, error) {
+	key, err := cl.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	vcCluster := *cl
+	vcCluster.Key = strings.TrimSpace(key)
+	vcCluster.Keypath = ""
+	clusterByte, err := yaml.Marshal(&vcCluster)
+	if err != nil {
+		return nil, err
+	}
+	var spec map[string]interface{}
+	if err := yaml.Unmarshal(clusterByte, &spec); err != nil {
+		return nil, err
+	}
+	// round trip through JSON for the number types of unstructured objects
+	specByte, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	spec = nil
+	if err := json.Unmarshal(specByte, &spec); err != nil {
+		return nil, err
+	}
+	delete(spec, "name")
+	delete(spec, "namespace")
+	vc := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": pruneEmpty(spec),
+		},
+	}
+	vc.SetAPIVersion(fmt.Sprintf("%s/%s", Group, Version))
+	vc.SetKind(Kind)
+	vc.SetName(cl.Name)
+	vc.SetNamespace(cl.Namespace)
+	return vc, nil
+}
+
+// toCluster converts a VirtualCluster into a cluster. Name and namespace are
+// taken from the metadata and the local files are kept below workdir.
+func toCluster(vc *unstructured.Unstructured, workdir string) (*cluster.Cluster, error) {
+	spec, _, err := unstructured.NestedMap(vc.Object, "spec")
+	if err != nil {
+		return nil, err
+	}
+	specByte, err := yaml.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	cl := &cluster.Cluster{}
+	if err := yaml.Unmarshal(specByte, cl); err != nil {
+		return nil, err
+	}
+	cl.Name = vc.GetName()
+	cl.Namespace = vc.GetNamespace()
+	cl.Kubeconfigdir = filepath.Join(workdir, vc.GetNamespace(), vc.GetName())
+	// the controller does not log in to the nodes
+	cl.Ssh.Skip = true
+	return cl, nil
+}
+
+// metadataCluster returns a cluster with only name, namespace and
+// Kubeconfigdir set, which is enough to delete the nodes and resources of a
+// VirtualCluster whose spec can't be converted.
+func metadataCluster(vc *unstructured.Unstructured, workdir string) *cluster.Cluster {
+	return &cluster.Cluster{
+		Name:          vc.GetName(),
+		Namespace:     vc.GetNamespace(),
+		Kubeconfigdir: filepath.Join(workdir, vc.GetNamespace(), vc.GetName()),
+	}
+}
+
+// pruneEmpty removes zero values, which mean the same as absent keys in the
+// cluster format.
+func pruneEmpty(value map[string]interface{}) map[string]interface{} {
+	for key, v := range value {
+		switch typed := v.(type) {
+		case map[string]interface{}:
+			if len(pruneEmpty(typed)) == 0 {
+				delete(value, key)
+			}
+		case []interface{}:
+			if len(typed) == 0 {
+				delete(value, key)
+			}
+			for _, item := range typed {
+				if itemMap, ok := item.(map[string]interface{}); ok {
+					pruneEmpty(itemMap)
+				}
+			}
+		case nil:
+			delete(value, key)
+		case string:
+			if typed == "" {
+				delete(value, key)
+			}
+		case bool:
+			if !typed {
+				delete(value, key)
+			}
+		case int64:
+			if typed == 0 {
+				delete(value, key)
+			}
+		case float64:
+			if typed == 0 {
+				delete(value, key)
+			}
+		}
+	}
+	return value
+}
+
+func toUnstructuredStatus(status VirtualClusterStatus) (map[string]interface{}, error) {
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+}
+
+func hasFinalizer(obj metav1.Object) bool {
+	for _, f := range obj.GetFinalizers() {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
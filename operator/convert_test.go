@@ -0,0 +1,182 @@
+package operator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"github.com/michaelhenkel/cn2kubevirt/roles"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func virtualCluster(spec map[string]interface{}) *unstructured.Unstructured {
+	vc := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": spec,
+		},
+	}
+	vc.SetName("cluster1")
+	vc.SetNamespace("ns1")
+	return vc
+}
+
+func TestToCluster(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    map[string]interface{}
+		want    *cluster.Cluster
+		wantErr bool
+	}{{
+		name: "metadata and defaults",
+		spec: map[string]interface{}{
+			"name":       "other",
+			"namespace":  "other",
+			"subnet":     "10.0.0.0/24",
+			"controller": int64(3),
+			"asn":        int64(64512),
+		},
+		want: &cluster.Cluster{
+			Name:          "cluster1",
+			Namespace:     "ns1",
+			Kubeconfigdir: "/work/ns1/cluster1",
+			Subnet:        "10.0.0.0/24",
+			Controller:    3,
+			Asn:           64512,
+			Ssh:           cluster.SSH{Skip: true},
+		},
+	}, {
+		name: "node pools",
+		spec: map[string]interface{}{
+			"nodePools": []interface{}{
+				map[string]interface{}{
+					"role":  "controller",
+					"count": int64(1),
+				},
+				map[string]interface{}{
+					"name":   "large",
+					"role":   "worker",
+					"count":  int64(2),
+					"labels": map[string]interface{}{"size": "large"},
+				},
+			},
+		},
+		want: &cluster.Cluster{
+			Name:          "cluster1",
+			Namespace:     "ns1",
+			Kubeconfigdir: "/work/ns1/cluster1",
+			Pools: []cluster.NodePool{{
+				Role:  roles.Controller,
+				Count: 1,
+			}, {
+				Name:   "large",
+				Role:   roles.Worker,
+				Count:  2,
+				Labels: map[string]string{"size": "large"},
+			}},
+			Ssh: cluster.SSH{Skip: true},
+		},
+	}, {
+		name: "ssh is never used",
+		spec: map[string]interface{}{
+			"ssh": map[string]interface{}{
+				"user": "admin",
+			},
+		},
+		want: &cluster.Cluster{
+			Name:          "cluster1",
+			Namespace:     "ns1",
+			Kubeconfigdir: "/work/ns1/cluster1",
+			Ssh:           cluster.SSH{User: "admin", Skip: true},
+		},
+	}, {
+		name:    "wrong type",
+		spec:    map[string]interface{}{"controller": "three"},
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toCluster(virtualCluster(tt.spec), "/work")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toCluster() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("toCluster() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneEmpty(t *testing.T) {
+	tests := []struct {
+		name  string
+		value map[string]interface{}
+		want  map[string]interface{}
+	}{{
+		name: "zero values",
+		value: map[string]interface{}{
+			"subnet": "",
+			"vmi":    false,
+			"asn":    int64(0),
+			"cpu":    float64(0),
+			"image":  nil,
+			"name":   "cluster1",
+		},
+		want: map[string]interface{}{
+			"name": "cluster1",
+		},
+	}, {
+		name: "nested maps",
+		value: map[string]interface{}{
+			"disk": map[string]interface{}{
+				"mode": "",
+				"size": "",
+			},
+			"expose": map[string]interface{}{
+				"type":     "nodeport",
+				"nodeport": int64(0),
+			},
+		},
+		want: map[string]interface{}{
+			"expose": map[string]interface{}{
+				"type": "nodeport",
+			},
+		},
+	}, {
+		name: "lists",
+		value: map[string]interface{}{
+			"networks": []interface{}{},
+			"nodePools": []interface{}{
+				map[string]interface{}{
+					"role":          "worker",
+					"addressoffset": int64(0),
+				},
+			},
+		},
+		want: map[string]interface{}{
+			"nodePools": []interface{}{
+				map[string]interface{}{
+					"role": "worker",
+				},
+			},
+		},
+	}, {
+		name: "kept values",
+		value: map[string]interface{}{
+			"controller": int64(3),
+			"vmi":        true,
+			"memory":     float64(1.5),
+		},
+		want: map[string]interface{}{
+			"controller": int64(3),
+			"vmi":        true,
+			"memory":     float64(1.5),
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pruneEmpty(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pruneEmpty() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
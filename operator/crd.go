@@ -0,0 +1,106 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/michaelhenkel/cn2kubevirt/k8s"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+)
+
+// DefineCustomResourceDefinition defines the VirtualCluster CRD. The spec is
+// the cluster file format and validated by the controller, not by a schema.
+func DefineCustomResourceDefinition() *apiextensionsv1.CustomResourceDefinition {
+	preserveUnknownFields := true
+	return &apiextensionsv1.CustomResourceDefinition{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apiextensionsv1.SchemeGroupVersion.String(),
+			Kind:       "CustomResourceDefinition",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("%s.%s", Resource, Group),
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: Group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Plural:     Resource,
+				Singular:   "virtualcluster",
+				Kind:       Kind,
+				ListKind:   Kind + "List",
+				ShortNames: []string{"vc"},
+			},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{
+				Name:    Version,
+				Served:  true,
+				Storage: true,
+				Schema: &apiextensionsv1.CustomResourceValidation{
+					OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+						Type: "object",
+						Properties: map[string]apiextensionsv1.JSONSchemaProps{
+							"spec": {
+								Type:                   "object",
+								XPreserveUnknownFields: &preserveUnknownFields,
+							},
+							"status": {
+								Type:                   "object",
+								XPreserveUnknownFields: &preserveUnknownFields,
+							},
+						},
+					},
+				},
+				Subresources: &apiextensionsv1.CustomResourceSubresources{
+					Status: &apiextensionsv1.CustomResourceSubresourceStatus{},
+				},
+				AdditionalPrinterColumns: []apiextensionsv1.CustomResourceColumnDefinition{{
+					Name:     "Phase",
+					Type:     "string",
+					JSONPath: ".status.phase",
+				}, {
+					Name:     "Service",
+					Type:     "string",
+					JSONPath: ".status.serviceIP",
+				}, {
+					Name:     "External",
+					Type:     "string",
+					JSONPath: ".status.externalEndpoint",
+				}, {
+					Name:     "Age",
+					Type:     "date",
+					JSONPath: ".metadata.creationTimestamp",
+				}},
+			}},
+		},
+	}
+}
+
+// InstallCustomResourceDefinition creates or updates the VirtualCluster CRD
+// with a server-side apply, an operator upgrade replaces an older definition.
+func InstallCustomResourceDefinition(client *k8s.Client) error {
+	crd := DefineCustomResourceDefinition()
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(crd)
+	if err != nil {
+		return err
+	}
+	// the status is owned by the API server
+	unstructured.RemoveNestedField(obj, "status")
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	force := true
+	if _, err := client.Apiextensions.ApiextensionsV1().CustomResourceDefinitions().Patch(context.Background(), crd.Name, types.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager: fieldManager,
+		Force:        &force,
+	}); err != nil {
+		return err
+	}
+	klog.Infof("applied custom resource definition %s", crd.Name)
+	return nil
+}
@@ -0,0 +1,47 @@
+package operator
+
+import (
+	"github.com/michaelhenkel/cn2kubevirt/kubevirt"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	Group    = "cn2kubevirt.io"
+	Version  = "v1alpha1"
+	Kind     = "VirtualCluster"
+	Resource = "virtualclusters"
+	// finalizer keeps the VirtualCluster until its nodes are deleted.
+	finalizer = "cn2kubevirt.io/nodes"
+	// fieldManager owns the fields of the applied CRD.
+	fieldManager = "cn2kubevirt"
+)
+
+var GroupVersionResource = schema.GroupVersionResource{
+	Group:    Group,
+	Version:  Version,
+	Resource: Resource,
+}
+
+type Phase string
+
+const (
+	// Pending clusters are accepted but have no nodes yet.
+	Pending Phase = "Pending"
+	// Provisioning clusters wait for their nodes to become ready.
+	Provisioning Phase = "Provisioning"
+	// Ready clusters have all nodes ready and their inventory written.
+	Ready Phase = "Ready"
+	// Failed clusters have an invalid spec or failed nodes.
+	Failed Phase = "Failed"
+	// Deleting clusters wait for their nodes to be deleted.
+	Deleting Phase = "Deleting"
+)
+
+type VirtualClusterStatus struct {
+	Phase              Phase                 `json:"phase"`
+	Message            string                `json:"message,omitempty"`
+	ObservedGeneration int64                 `json:"observedGeneration,omitempty"`
+	ServiceIP          string                `json:"serviceIP,omitempty"`
+	ExternalEndpoint   string                `json:"externalEndpoint,omitempty"`
+	Nodes              []kubevirt.NodeStatus `json:"nodes,omitempty"`
+}
@@ -11,4 +11,6 @@ type NetworkAnnotation struct {
 	Name      string
 	Interface string
 	Ips       []string
+	// Default is set for the pod network.
+	Default bool
 }
@@ -0,0 +1,157 @@
+package sshprobe
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/michaelhenkel/cn2kubevirt/cluster"
+	"github.com/michaelhenkel/cn2kubevirt/inventory"
+	hd "github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/ssh"
+	"k8s.io/klog"
+)
+
+const (
+	probeInterval = 5 * time.Second
+	dialTimeout   = 10 * time.Second
+)
+
+// WaitForNodes blocks until every node accepts SSH connections with the
+// cluster key and, if configured, cloud-init has finished on it.
+func WaitForNodes(instanceMap map[string]inventory.InstanceIPRole, cl *cluster.Cluster) error {
+	config, err := clientConfig(cl)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(cl.ReadinessTimeout())
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var failed []string
+	for name, inst := range instanceMap {
+		ansibleHost, _ := inst.Addresses(*cl)
+		if ansibleHost == "" {
+			mutex.Lock()
+			failed = append(failed, fmt.Sprintf("%s (no address)", name))
+			mutex.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(name, address string) {
+			defer wg.Done()
+			if err := waitForNode(name, address, cl, config, deadline); err != nil {
+				mutex.Lock()
+				failed = append(failed, fmt.Sprintf("%s (%s)", name, err))
+				mutex.Unlock()
+			}
+		}(name, ansibleHost)
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("nodes not reachable by ssh: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func waitForNode(name, address string, cl *cluster.Cluster, config *ssh.ClientConfig, deadline time.Time) error {
+	for {
+		err := probe(address, cl, config, deadline)
+		if err == nil {
+			klog.Infof("node %s is reachable by ssh", name)
+			return nil
+		}
+		if time.Now().Add(probeInterval).After(deadline) {
+			return err
+		}
+		time.Sleep(probeInterval)
+	}
+}
+
+// probe connects to the node, directly or through the jump host, and runs
+// cloud-init status --wait if requested until deadline.
+func probe(address string, cl *cluster.Cluster, config *ssh.ClientConfig, deadline time.Time) error {
+	nodeAddress := net.JoinHostPort(address, "22")
+	var client *ssh.Client
+	if cl.Ssh.Jumphost != "" {
+		jumpConfig := *config
+		jumpAddress := cl.Ssh.Jumphost
+		if idx := strings.LastIndex(jumpAddress, "@"); idx >= 0 {
+			jumpConfig.User = jumpAddress[:idx]
+			jumpAddress = jumpAddress[idx+1:]
+		}
+		if _, _, err := net.SplitHostPort(jumpAddress); err != nil {
+			jumpAddress = net.JoinHostPort(jumpAddress, "22")
+		}
+		jumpClient, err := ssh.Dial("tcp", jumpAddress, &jumpConfig)
+		if err != nil {
+			return err
+		}
+		defer jumpClient.Close()
+		conn, err := jumpClient.Dial("tcp", nodeAddress)
+		if err != nil {
+			return err
+		}
+		clientConn, chans, reqs, err := ssh.NewClientConn(conn, nodeAddress, config)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		client = ssh.NewClient(clientConn, chans, reqs)
+	} else {
+		var err error
+		client, err = ssh.Dial("tcp", nodeAddress, config)
+		if err != nil {
+			return err
+		}
+	}
+	defer client.Close()
+	if !cl.Ssh.Cloudinit {
+		return nil
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	// cloud-init status --wait doesn't return if cloud-init hangs, closing
+	// the connection ends the session at the deadline
+	timer := time.AfterFunc(time.Until(deadline), func() {
+		client.Close()
+	})
+	defer timer.Stop()
+	if out, err := session.CombinedOutput("cloud-init status --wait"); err != nil {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("cloud-init not finished before the readiness timeout")
+		}
+		return fmt.Errorf("cloud-init: %s: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func clientConfig(cl *cluster.Cluster) (*ssh.ClientConfig, error) {
+	keypath, err := hd.Expand(cl.PrivateKeypath())
+	if err != nil {
+		return nil, err
+	}
+	key, err := ioutil.ReadFile(keypath)
+	if err != nil {
+		return nil, fmt.Errorf("ssh private key: %s", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", keypath, err)
+	}
+	return &ssh.ClientConfig{
+		User: cl.SSHUser(),
+		Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		// the nodes are recreated with new host keys, the inventory
+		// disables host key checking for the same reason.
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         dialTimeout,
+	}, nil
+}